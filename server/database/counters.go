@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// recountBatchSize is how many content rows are recounted per statement, to
+// keep row locks short while the server keeps serving votes
+const recountBatchSize = 1000
+
+// RecountUpvotes recomputes content.upvote_count from the upvotes table in
+// batches and returns how many rows were corrected. The trigger keeps the
+// counter in sync; this repairs drift after manual edits or restores.
+func RecountUpvotes(ctx context.Context, pool *pgxpool.Pool) (int64, error) {
+	var maxID int
+	if err := pool.QueryRow(ctx, `SELECT COALESCE(MAX(id), 0) FROM content`).Scan(&maxID); err != nil {
+		return 0, fmt.Errorf("error reading content ids: %v", err)
+	}
+
+	var corrected int64
+	for start := 1; start <= maxID; start += recountBatchSize {
+		tag, err := pool.Exec(ctx, `
+			UPDATE content c SET upvote_count = counts.total
+			FROM (
+				SELECT c2.id, COUNT(u.id) AS total
+				FROM content c2
+				LEFT JOIN upvotes u ON u.content_id = c2.id
+				WHERE c2.id BETWEEN $1 AND $2
+				GROUP BY c2.id
+			) counts
+			WHERE c.id = counts.id AND c.upvote_count <> counts.total
+		`, start, start+recountBatchSize-1)
+		if err != nil {
+			return corrected, fmt.Errorf("error recounting upvotes for ids %d-%d: %v", start, start+recountBatchSize-1, err)
+		}
+		corrected += tag.RowsAffected()
+	}
+
+	return corrected, nil
+}
@@ -12,8 +12,36 @@ import (
 
 var DBPool *pgxpool.Pool
 
-// InitDB initializes the database connection pool
+// InitDB initializes the database connection pool and applies pending migrations
 func InitDB() (*pgxpool.Pool, error) {
+	pool, err := Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	// Bring the schema up to date unless migrations are run separately
+	if os.Getenv("SKIP_MIGRATIONS") == "true" {
+		log.Println("SKIP_MIGRATIONS is set, not applying migrations")
+		return pool, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	applied, err := MigrateUp(ctx, pool)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("unable to migrate database: %v", err)
+	}
+	if applied > 0 {
+		log.Printf("Applied %d migration(s)", applied)
+	}
+
+	return pool, nil
+}
+
+// Connect creates the database connection pool without touching the schema
+func Connect() (*pgxpool.Pool, error) {
 	// Get database connection string from environment
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
@@ -51,214 +79,5 @@ func InitDB() (*pgxpool.Pool, error) {
 	// Set global connection pool
 	DBPool = pool
 
-	// Initialize database schema if needed
-	if err := initializeSchema(ctx, pool); err != nil {
-		log.Printf("Warning: Could not initialize schema: %v", err)
-	}
-
 	return pool, nil
 }
-
-// initializeSchema creates the database tables if they don't exist
-func initializeSchema(ctx context.Context, pool *pgxpool.Pool) error {
-	// Create users table
-	_, err := pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			username VARCHAR(50) UNIQUE NOT NULL,
-			email VARCHAR(255) UNIQUE NOT NULL,
-			password_hash VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating users table: %v", err)
-	}
-
-	// Create content table
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS content (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER REFERENCES users(id),
-			title VARCHAR(255) NOT NULL,
-			description TEXT,
-			image_count INTEGER DEFAULT 0,
-			video_count INTEGER DEFAULT 0,
-			thumbnail_url VARCHAR(255),
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating content table: %v", err)
-	}
-
-	// Create tags table
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS tags (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(50) UNIQUE NOT NULL
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating tags table: %v", err)
-	}
-
-	// Create content_tags junction table
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS content_tags (
-			content_id INTEGER REFERENCES content(id),
-			tag_id INTEGER REFERENCES tags(id),
-			PRIMARY KEY (content_id, tag_id)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating content_tags table: %v", err)
-	}
-
-	// Create content_images table to store all images for each content
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS content_images (
-			id SERIAL PRIMARY KEY,
-			content_id INTEGER REFERENCES content(id) ON DELETE CASCADE,
-			image_url VARCHAR(500) NOT NULL,
-			image_order INTEGER DEFAULT 0,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating content_images table: %v", err)
-	}
-
-	// Create index for content_images
-	_, err = pool.Exec(ctx, `
-		CREATE INDEX IF NOT EXISTS idx_content_images_content_id ON content_images(content_id);
-		CREATE INDEX IF NOT EXISTS idx_content_images_order ON content_images(content_id, image_order);
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating content_images indexes: %v", err)
-	}
-
-	// Create upvotes table
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS upvotes (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER REFERENCES users(id),
-			content_id INTEGER REFERENCES content(id),
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(user_id, content_id)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating upvotes table: %v", err)
-	}
-
-	// Create follows table
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS follows (
-			follower_id INTEGER REFERENCES users(id),
-			following_id INTEGER REFERENCES users(id),
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (follower_id, following_id)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating follows table: %v", err)
-	}
-
-	// Create trading_content table
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS trading_content (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER REFERENCES users(id),
-			title VARCHAR(255) NOT NULL,
-			description TEXT,
-			file_url VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			is_traded BOOLEAN DEFAULT FALSE
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating trading_content table: %v", err)
-	}
-
-	// Create trade_requests table
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS trade_requests (
-			id SERIAL PRIMARY KEY,
-			from_user_id INTEGER REFERENCES users(id),
-			to_user_id INTEGER REFERENCES users(id),
-			trading_content_id INTEGER REFERENCES trading_content(id),
-			offered_content_id INTEGER REFERENCES trading_content(id),
-			status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected')),
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating trade_requests table: %v", err)
-	}
-
-	// Create collections table
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS collections (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER REFERENCES users(id),
-			name VARCHAR(255) NOT NULL,
-			description TEXT,
-			is_public BOOLEAN DEFAULT FALSE,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating collections table: %v", err)
-	}
-
-	// Create collection_content junction table
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS collection_content (
-			id SERIAL PRIMARY KEY,
-			collection_id INTEGER REFERENCES collections(id) ON DELETE CASCADE,
-			content_id INTEGER REFERENCES content(id) ON DELETE CASCADE,
-			added_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(collection_id, content_id)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating collection_content table: %v", err)
-	}
-
-	// Fix messages table - drop and recreate if it exists with wrong schema
-	_, err = pool.Exec(ctx, `DROP TABLE IF EXISTS messages CASCADE`)
-	if err != nil {
-		return fmt.Errorf("error dropping messages table: %v", err)
-	}
-
-	// Create messages table with correct schema
-	_, err = pool.Exec(ctx, `
-		CREATE TABLE messages (
-			id SERIAL PRIMARY KEY,
-			from_user_id INTEGER REFERENCES users(id),
-			to_user_id INTEGER REFERENCES users(id),
-			message TEXT NOT NULL,
-			attachment_url TEXT,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			read_at TIMESTAMP WITH TIME ZONE NULL
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating messages table: %v", err)
-	}
-
-	// Create index for better query performance
-	_, err = pool.Exec(ctx, `
-		CREATE INDEX IF NOT EXISTS idx_messages_users ON messages(from_user_id, to_user_id);
-		CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
-	`)
-	if err != nil {
-		return fmt.Errorf("error creating messages indexes: %v", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS collection_content;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS trade_requests;
+DROP TABLE IF EXISTS trading_content;
+DROP TABLE IF EXISTS follows;
+DROP TABLE IF EXISTS upvotes;
+DROP TABLE IF EXISTS content_images;
+DROP TABLE IF EXISTS content_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS content;
+DROP TABLE IF EXISTS users;
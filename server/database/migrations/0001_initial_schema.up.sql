@@ -0,0 +1,111 @@
+-- Baseline schema. Every statement is idempotent so databases created by the
+-- old startup DDL adopt this migration without losing data.
+
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	username VARCHAR(50) UNIQUE NOT NULL,
+	email VARCHAR(255) UNIQUE NOT NULL,
+	password_hash VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS content (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id),
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	image_count INTEGER DEFAULT 0,
+	video_count INTEGER DEFAULT 0,
+	thumbnail_url VARCHAR(255),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(50) UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS content_tags (
+	content_id INTEGER REFERENCES content(id),
+	tag_id INTEGER REFERENCES tags(id),
+	PRIMARY KEY (content_id, tag_id)
+);
+
+CREATE TABLE IF NOT EXISTS content_images (
+	id SERIAL PRIMARY KEY,
+	content_id INTEGER REFERENCES content(id) ON DELETE CASCADE,
+	image_url VARCHAR(500) NOT NULL,
+	image_order INTEGER DEFAULT 0,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_images_content_id ON content_images(content_id);
+CREATE INDEX IF NOT EXISTS idx_content_images_order ON content_images(content_id, image_order);
+
+CREATE TABLE IF NOT EXISTS upvotes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id),
+	content_id INTEGER REFERENCES content(id),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(user_id, content_id)
+);
+
+CREATE TABLE IF NOT EXISTS follows (
+	follower_id INTEGER REFERENCES users(id),
+	following_id INTEGER REFERENCES users(id),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (follower_id, following_id)
+);
+
+CREATE TABLE IF NOT EXISTS trading_content (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id),
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	file_url VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	is_traded BOOLEAN DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS trade_requests (
+	id SERIAL PRIMARY KEY,
+	from_user_id INTEGER REFERENCES users(id),
+	to_user_id INTEGER REFERENCES users(id),
+	trading_content_id INTEGER REFERENCES trading_content(id),
+	offered_content_id INTEGER REFERENCES trading_content(id),
+	status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected')),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS collections (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id),
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	is_public BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS collection_content (
+	id SERIAL PRIMARY KEY,
+	collection_id INTEGER REFERENCES collections(id) ON DELETE CASCADE,
+	content_id INTEGER REFERENCES content(id) ON DELETE CASCADE,
+	added_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(collection_id, content_id)
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id SERIAL PRIMARY KEY,
+	from_user_id INTEGER REFERENCES users(id),
+	to_user_id INTEGER REFERENCES users(id),
+	message TEXT NOT NULL,
+	attachment_url TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	read_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_users ON messages(from_user_id, to_user_id);
+CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
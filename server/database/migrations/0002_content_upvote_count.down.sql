@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_upvotes_content_id;
+DROP INDEX IF EXISTS idx_content_upvote_count;
+DROP TRIGGER IF EXISTS upvotes_sync_content_count ON upvotes;
+DROP FUNCTION IF EXISTS sync_content_upvote_count();
+ALTER TABLE content DROP COLUMN IF EXISTS upvote_count;
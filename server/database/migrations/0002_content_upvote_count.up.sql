@@ -0,0 +1,31 @@
+-- Denormalized upvote counter so feeds can sort and filter without counting
+-- the upvotes table per row. Kept in sync by a trigger on upvotes.
+
+ALTER TABLE content ADD COLUMN IF NOT EXISTS upvote_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION sync_content_upvote_count() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		UPDATE content SET upvote_count = upvote_count + 1 WHERE id = NEW.content_id;
+	ELSIF TG_OP = 'DELETE' THEN
+		UPDATE content SET upvote_count = upvote_count - 1 WHERE id = OLD.content_id;
+	ELSIF NEW.content_id IS DISTINCT FROM OLD.content_id THEN
+		UPDATE content SET upvote_count = upvote_count - 1 WHERE id = OLD.content_id;
+		UPDATE content SET upvote_count = upvote_count + 1 WHERE id = NEW.content_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS upvotes_sync_content_count ON upvotes;
+CREATE TRIGGER upvotes_sync_content_count
+	AFTER INSERT OR DELETE OR UPDATE OF content_id ON upvotes
+	FOR EACH ROW EXECUTE FUNCTION sync_content_upvote_count();
+
+-- Backfill existing votes
+UPDATE content c SET upvote_count = counts.total
+FROM (SELECT content_id, COUNT(*) AS total FROM upvotes GROUP BY content_id) counts
+WHERE c.id = counts.content_id;
+
+CREATE INDEX IF NOT EXISTS idx_content_upvote_count ON content(upvote_count DESC, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_upvotes_content_id ON upvotes(content_id);
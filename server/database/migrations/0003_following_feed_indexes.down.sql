@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_content_created;
+DROP INDEX IF EXISTS idx_content_user_created;
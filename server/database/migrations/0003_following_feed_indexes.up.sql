@@ -0,0 +1,4 @@
+-- Per-author content index so the following feed can merge recent posts from
+-- many followed accounts without scanning the whole content table.
+CREATE INDEX IF NOT EXISTS idx_content_user_created ON content(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_content_created ON content(created_at DESC, id DESC);
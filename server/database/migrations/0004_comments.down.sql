@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS comments_sync_content_count ON comments;
+DROP FUNCTION IF EXISTS sync_content_comment_count();
+ALTER TABLE content DROP COLUMN IF EXISTS comment_count;
+DROP TABLE IF EXISTS comments;
@@ -0,0 +1,43 @@
+-- Threaded comments on content. Deleted comments are kept as tombstones so
+-- their replies stay attached to the thread.
+
+CREATE TABLE IF NOT EXISTS comments (
+	id SERIAL PRIMARY KEY,
+	content_id INTEGER NOT NULL REFERENCES content(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id),
+	parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	deleted_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_thread ON comments(content_id, parent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments(parent_id, created_at, id);
+
+ALTER TABLE content ADD COLUMN IF NOT EXISTS comment_count INTEGER NOT NULL DEFAULT 0;
+
+-- comment_count counts comments that have not been deleted
+CREATE OR REPLACE FUNCTION sync_content_comment_count() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		IF NEW.deleted_at IS NULL THEN
+			UPDATE content SET comment_count = comment_count + 1 WHERE id = NEW.content_id;
+		END IF;
+	ELSIF TG_OP = 'DELETE' THEN
+		IF OLD.deleted_at IS NULL THEN
+			UPDATE content SET comment_count = comment_count - 1 WHERE id = OLD.content_id;
+		END IF;
+	ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+		UPDATE content SET comment_count = comment_count - 1 WHERE id = NEW.content_id;
+	ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+		UPDATE content SET comment_count = comment_count + 1 WHERE id = NEW.content_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS comments_sync_content_count ON comments;
+CREATE TRIGGER comments_sync_content_count
+	AFTER INSERT OR DELETE OR UPDATE OF deleted_at ON comments
+	FOR EACH ROW EXECUTE FUNCTION sync_content_comment_count();
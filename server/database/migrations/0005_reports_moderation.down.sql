@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reports;
+DROP INDEX IF EXISTS idx_content_moderation_pending;
+ALTER TABLE content DROP COLUMN IF EXISTS moderation_status;
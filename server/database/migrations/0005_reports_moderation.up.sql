@@ -0,0 +1,29 @@
+-- User reports against content, trading items, collections, messages and
+-- comments, plus a moderation state that hides reported content while pending.
+
+ALTER TABLE content ADD COLUMN IF NOT EXISTS moderation_status VARCHAR(20) NOT NULL DEFAULT 'approved'
+	CHECK (moderation_status IN ('approved', 'pending', 'removed'));
+
+CREATE INDEX IF NOT EXISTS idx_content_moderation_pending ON content(created_at) WHERE moderation_status = 'pending';
+
+CREATE TABLE IF NOT EXISTS reports (
+	id SERIAL PRIMARY KEY,
+	reporter_id INTEGER REFERENCES users(id),
+	target_type VARCHAR(20) NOT NULL
+		CHECK (target_type IN ('content', 'trading_content', 'collection', 'message', 'comment')),
+	target_id INTEGER NOT NULL,
+	reason VARCHAR(30) NOT NULL
+		CHECK (reason IN ('spam', 'harassment', 'non_consensual', 'underage', 'copyright', 'illegal', 'other')),
+	details TEXT,
+	status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'upheld', 'dismissed')),
+	resolved_by INTEGER REFERENCES users(id),
+	resolved_at TIMESTAMP WITH TIME ZONE NULL,
+	resolution_note TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One open report per reporter and target
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_open_unique
+	ON reports(reporter_id, target_type, target_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_reports_target ON reports(target_type, target_id, status);
+CREATE INDEX IF NOT EXISTS idx_reports_status_created ON reports(status, created_at);
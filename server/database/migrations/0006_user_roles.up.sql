@@ -0,0 +1,3 @@
+-- Role-based access control. Every account is a plain user unless promoted.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user'
+	CHECK (role IN ('user', 'moderator', 'admin'));
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_content_user_id;
+DROP INDEX IF EXISTS idx_users_last_active_at;
+DROP INDEX IF EXISTS idx_users_created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS suspension_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS suspended_at;
+ALTER TABLE users DROP COLUMN IF EXISTS last_active_at;
@@ -0,0 +1,24 @@
+-- A session is one login: the refresh token family it owns plus where it was
+-- last used from. Revoking a session revokes its refresh tokens and makes
+-- AuthMiddleware reject access tokens issued for it.
+CREATE TABLE IF NOT EXISTS sessions (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	family_id TEXT NOT NULL UNIQUE,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	revoked_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id, last_seen_at DESC);
+
+-- Logins made before sessions existed become sessions with unknown origin
+INSERT INTO sessions (user_id, family_id, created_at, last_seen_at, expires_at, revoked_at)
+SELECT user_id, family_id, MIN(created_at), MAX(created_at), MAX(expires_at),
+       CASE WHEN BOOL_AND(revoked_at IS NOT NULL) THEN MAX(revoked_at) END
+FROM refresh_tokens
+GROUP BY user_id, family_id
+ON CONFLICT (family_id) DO NOTHING;
@@ -0,0 +1,6 @@
+-- Email verification. Accounts created before verification existed are
+-- treated as verified so they keep access to uploading and trading.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verification_sent_at TIMESTAMP WITH TIME ZONE NULL;
+
+UPDATE users SET verified_at = created_at WHERE verified_at IS NULL;
@@ -0,0 +1,22 @@
+-- Failed login counters per throttle key ("account:<email>" or "ip:<address>").
+-- Once failures pass a threshold the key is locked with exponential backoff.
+CREATE TABLE IF NOT EXISTS login_throttles (
+	key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	locked_until TIMESTAMP WITH TIME ZONE NULL
+);
+
+-- Failed logins and lockouts, for the admin panel. user_id is set when the
+-- email belongs to an account.
+CREATE TABLE IF NOT EXISTS login_events (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	ip_address TEXT NOT NULL,
+	event_type VARCHAR(20) NOT NULL CHECK (event_type IN ('failure', 'lockout')),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_created ON login_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_login_events_user ON login_events(user_id, created_at);
@@ -0,0 +1,34 @@
+-- Accounts at external OpenID Connect providers linked to users. Users who
+-- signed up through a provider have an empty password_hash until they set one
+-- with the password reset flow.
+CREATE TABLE IF NOT EXISTS user_identities (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider VARCHAR(50) NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	last_login_at TIMESTAMP WITH TIME ZONE NULL,
+	UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
+-- In-flight logins: the state sent to the provider, with the PKCE verifier and
+-- nonce needed to finish it. link_user_id is set when a signed-in user is
+-- linking a provider. Each row is consumed by the callback and then by the
+-- completion request.
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+	id SERIAL PRIMARY KEY,
+	state_hash TEXT NOT NULL UNIQUE,
+	provider VARCHAR(50) NOT NULL,
+	code_verifier TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	link_user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	callback_at TIMESTAMP WITH TIME ZONE NULL,
+	completed_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expires ON oidc_login_states(expires_at);
@@ -0,0 +1,16 @@
+-- Personal access tokens for scripts. Only SHA-256 hashes are stored;
+-- token_prefix keeps the first characters so users can tell tokens apart.
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	token_prefix VARCHAR(20) NOT NULL,
+	scopes TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP WITH TIME ZONE NULL,
+	last_used_at TIMESTAMP WITH TIME ZONE NULL,
+	revoked_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user ON personal_access_tokens(user_id, created_at);
@@ -0,0 +1,7 @@
+-- Self-service account deletion. A scheduled account is purged by the
+-- deletion worker once deletion_scheduled_for has passed.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_for TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_for ON users(deletion_scheduled_for)
+	WHERE deletion_scheduled_for IS NOT NULL;
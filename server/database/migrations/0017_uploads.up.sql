@@ -0,0 +1,13 @@
+-- Every file stored through the upload endpoints, with its owner. Content can
+-- only attach files its author uploaded.
+CREATE TABLE IF NOT EXISTS uploads (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url TEXT NOT NULL UNIQUE,
+	size_bytes BIGINT NOT NULL,
+	mime_type VARCHAR(100) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_user ON uploads(user_id, created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_uploads_variants_pending;
+DROP TABLE IF EXISTS image_variants;
+ALTER TABLE uploads DROP COLUMN IF EXISTS variants_processed_at;
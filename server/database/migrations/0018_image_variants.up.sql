@@ -0,0 +1,18 @@
+-- Resized JPEG copies of uploaded images, generated in the background for
+-- responsive images and thumbnails. Uploads are picked up until
+-- variants_processed_at is set, including those stored before this migration.
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS variants_processed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS image_variants (
+	id SERIAL PRIMARY KEY,
+	upload_id INTEGER NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	url TEXT NOT NULL UNIQUE,
+	size_bytes BIGINT NOT NULL,
+	mime_type VARCHAR(100) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(upload_id, width)
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_variants_pending ON uploads(id) WHERE variants_processed_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE uploads DROP COLUMN IF EXISTS variants_retry_at;
+ALTER TABLE uploads DROP COLUMN IF EXISTS variants_attempts;
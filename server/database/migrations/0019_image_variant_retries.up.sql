@@ -0,0 +1,4 @@
+-- Failed variant generation is retried with a growing delay instead of
+-- blocking the queue; after too many attempts the upload is marked processed.
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS variants_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS variants_retry_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,2 @@
+-- Nothing to undo: WebP uploads keep any variants generated for them
+SELECT 1;
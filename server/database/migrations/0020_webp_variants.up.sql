@@ -0,0 +1,4 @@
+-- WebP images can now be resized; queue those stored before that again
+UPDATE uploads SET variants_processed_at = NULL, variants_attempts = 0, variants_retry_at = NULL
+WHERE mime_type = 'image/webp'
+  AND NOT EXISTS (SELECT 1 FROM image_variants v WHERE v.upload_id = uploads.id);
@@ -0,0 +1,2 @@
+-- Emails are looked up case-insensitively
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email));
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// devAuthorization is an authorization code issued by the development provider
+type devAuthorization struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	email         string
+	expiresAt     time.Time
+}
+
+var devLoginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<title>Development identity provider</title>
+<h1>Sign in to the development provider</h1>
+<form method="post">
+	{{range $name, $value := .}}<input type="hidden" name="{{$name}}" value="{{index $value 0}}">{{end}}
+	<label>Email <input name="email" type="email" required autofocus></label>
+	<button type="submit">Sign in</button>
+</form>
+`))
+
+// runDevOIDCProviderCommand handles "server dev-oidc-provider [addr]". It runs
+// a minimal OpenID Connect provider for trying the login flow end to end
+// without a real identity provider; any email typed into its form signs in
+// with a stable subject derived from that email. Never expose it publicly.
+func runDevOIDCProviderCommand(args []string) int {
+	addr := "localhost:9000"
+	if len(args) > 0 {
+		addr = args[0]
+	}
+	issuer := "http://" + addr
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Printf("Error generating signing key: %v", err)
+		return 1
+	}
+	const kid = "dev"
+
+	var mu sync.Mutex
+	codes := map[string]devAuthorization{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		params := url.Values{}
+		for _, name := range []string{"client_id", "redirect_uri", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			params.Set(name, r.Form.Get(name))
+		}
+		if params.Get("client_id") == "" || params.Get("redirect_uri") == "" {
+			http.Error(w, "client_id and redirect_uri are required", http.StatusBadRequest)
+			return
+		}
+		if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+			http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+			return
+		}
+
+		email := strings.TrimSpace(r.PostForm.Get("email"))
+		if r.Method != http.MethodPost || email == "" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			devLoginPage.Execute(w, params)
+			return
+		}
+
+		code := randomDevToken()
+		mu.Lock()
+		codes[code] = devAuthorization{
+			clientID:      params.Get("client_id"),
+			redirectURI:   params.Get("redirect_uri"),
+			nonce:         params.Get("nonce"),
+			codeChallenge: params.Get("code_challenge"),
+			email:         email,
+			expiresAt:     time.Now().Add(time.Minute),
+		}
+		mu.Unlock()
+
+		redirect, err := url.Parse(params.Get("redirect_uri"))
+		if err != nil {
+			http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+			return
+		}
+		query := redirect.Query()
+		query.Set("code", code)
+		query.Set("state", params.Get("state"))
+		redirect.RawQuery = query.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ParseForm() != nil {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		auth, ok := codes[r.PostForm.Get("code")]
+		delete(codes, r.PostForm.Get("code"))
+		mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || time.Now().After(auth.expiresAt) ||
+			auth.clientID != r.PostForm.Get("client_id") ||
+			auth.redirectURI != r.PostForm.Get("redirect_uri") ||
+			auth.codeChallenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		subject := sha256.Sum256([]byte(strings.ToLower(auth.email)))
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                issuer,
+			"sub":                base64.RawURLEncoding.EncodeToString(subject[:12]),
+			"aud":                auth.clientID,
+			"iat":                now.Unix(),
+			"exp":                now.Add(5 * time.Minute).Unix(),
+			"nonce":              auth.nonce,
+			"email":              auth.email,
+			"email_verified":     true,
+			"preferred_username": strings.SplitN(auth.email, "@", 2)[0],
+		})
+		token.Header["kid"] = kid
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, `{"error":"server_error"}`, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": randomDevToken(),
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     idToken,
+		})
+	})
+
+	fmt.Printf("Development OIDC provider running at %s\n", issuer)
+	fmt.Printf("Configure the server with OIDC_PROVIDERS=dev OIDC_DEV_ISSUER=%s OIDC_DEV_CLIENT_ID=arouzy\n", issuer)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Development provider stopped: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// randomDevToken returns a random URL-safe string for codes issued by the development provider
+func randomDevToken() string {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"project/server/storage"
+)
+
+// runDevS3Command handles "server dev-s3 [addr] [dir]". It runs a small
+// S3-compatible object store keeping files in dir, for trying the s3 storage
+// driver end to end without a cloud bucket. Never expose it publicly.
+func runDevS3Command(args []string) int {
+	addr := "localhost:9100"
+	if len(args) > 0 {
+		addr = args[0]
+	}
+	dir := "./dev-s3"
+	if len(args) > 1 {
+		dir = args[1]
+	}
+	const bucket, accessKey, secretKey, region = "arouzy", "dev-access-key", "dev-secret-key", "us-east-1"
+
+	server, err := storage.NewDevServer(dir, bucket, accessKey, secretKey, region)
+	if err != nil {
+		log.Printf("Error preparing object directory: %v", err)
+		return 1
+	}
+
+	fmt.Printf("Development object store running at http://%s, keeping objects in %s\n", addr, dir)
+	fmt.Printf("Configure the server with STORAGE_DRIVER=s3 S3_ENDPOINT=http://%s S3_BUCKET=%s S3_ACCESS_KEY_ID=%s S3_SECRET_ACCESS_KEY=%s\n",
+		addr, bucket, accessKey, secretKey)
+	if err := http.ListenAndServe(addr, server); err != nil {
+		log.Printf("Development object store stopped: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"project/server/database"
+	"project/server/mail"
+	"project/server/middleware"
+	"project/server/models"
+	"project/server/storage"
+	"project/server/utils"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// accountDeletionGracePeriod is how long a user can change their mind
+	// after asking for their account to be deleted
+	accountDeletionGracePeriod = 14 * 24 * time.Hour
+	// accountDeletionCheckInterval is how often the deletion worker looks for
+	// accounts whose grace period has ended
+	accountDeletionCheckInterval = time.Hour
+)
+
+// userFilesQuery lists the uploaded files tied to a user ($1): everything they
+// uploaded, images of their content, their trading files and attachments of
+// their conversations
+const userFilesQuery = `
+	SELECT url FROM uploads WHERE user_id = $1
+	UNION SELECT ci.image_url FROM content_images ci JOIN content c ON c.id = ci.content_id WHERE c.user_id = $1
+	UNION SELECT thumbnail_url FROM content WHERE user_id = $1 AND thumbnail_url IS NOT NULL
+	UNION SELECT file_url FROM trading_content WHERE user_id = $1
+	UNION SELECT attachment_url FROM messages
+	WHERE (from_user_id = $1 OR to_user_id = $1) AND attachment_url IS NOT NULL`
+
+// purgeUserTx deletes a user and everything they own within tx. Comments are
+// kept as anonymous tombstones so other users' replies stay in their threads,
+// and reports they filed or resolved are kept without the reference. It
+// returns the URLs of uploaded files the deleted rows pointed at; pass them to
+// removeUploadedFiles once the transaction has committed.
+func purgeUserTx(ctx context.Context, tx pgx.Tx, userID int) ([]string, error) {
+	// Files referenced by rows that are about to be deleted
+	rows, err := tx.Query(ctx, userFilesQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %v", err)
+	}
+	fileURLs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %v", err)
+	}
+
+	// Resized copies of those images go with them
+	rows, err = tx.Query(ctx, `
+		SELECT v.url FROM image_variants v
+		JOIN uploads u ON u.id = v.upload_id
+		WHERE u.url = ANY($1)
+	`, fileURLs)
+	if err != nil {
+		return nil, fmt.Errorf("error listing image variants: %v", err)
+	}
+	variantURLs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error listing image variants: %v", err)
+	}
+	fileURLs = append(fileURLs, variantURLs...)
+
+	// Content authored by the user, with its votes, comments and images
+	rows, err = tx.Query(ctx, `SELECT id FROM content WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing content: %v", err)
+	}
+	contentIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("error listing content: %v", err)
+	}
+	for _, contentID := range contentIDs {
+		contentFiles, err := deleteContentTx(ctx, tx, contentID)
+		if err != nil {
+			return nil, fmt.Errorf("error deleting content %d: %v", contentID, err)
+		}
+		fileURLs = append(fileURLs, contentFiles...)
+	}
+
+	statements := []string{
+		`DELETE FROM upvotes WHERE user_id = $1`,
+		`DELETE FROM follows WHERE follower_id = $1 OR following_id = $1`,
+		`UPDATE comments SET user_id = NULL, body = '', deleted_at = COALESCE(deleted_at, NOW()), updated_at = NOW()
+		 WHERE user_id = $1`,
+		`DELETE FROM collections WHERE user_id = $1`,
+		`DELETE FROM trade_requests WHERE from_user_id = $1 OR to_user_id = $1
+		 OR trading_content_id IN (SELECT id FROM trading_content WHERE user_id = $1)
+		 OR offered_content_id IN (SELECT id FROM trading_content WHERE user_id = $1)`,
+		`DELETE FROM trading_content WHERE user_id = $1`,
+		`DELETE FROM messages WHERE from_user_id = $1 OR to_user_id = $1`,
+		`UPDATE reports SET reporter_id = NULL WHERE reporter_id = $1`,
+		`UPDATE reports SET resolved_by = NULL WHERE resolved_by = $1`,
+		`DELETE FROM users WHERE id = $1`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(ctx, stmt, userID); err != nil {
+			return nil, fmt.Errorf("error running %q: %v", stmt, err)
+		}
+	}
+	return fileURLs, nil
+}
+
+// removeUploadedFiles deletes uploaded files that no remaining row refers to.
+// Errors are logged; a leftover file is not worth failing a deletion over.
+func removeUploadedFiles(ctx context.Context, fileURLs []string) {
+	if len(fileURLs) == 0 {
+		return
+	}
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT candidate.url FROM unnest($1::text[]) AS candidate(url)
+		WHERE NOT EXISTS (SELECT 1 FROM content_images WHERE image_url = candidate.url)
+		  AND NOT EXISTS (SELECT 1 FROM content WHERE thumbnail_url = candidate.url)
+		  AND NOT EXISTS (SELECT 1 FROM trading_content WHERE file_url = candidate.url)
+		  AND NOT EXISTS (SELECT 1 FROM messages WHERE attachment_url = candidate.url)
+		  AND NOT EXISTS (SELECT 1 FROM uploads WHERE url = candidate.url)
+		  AND NOT EXISTS (SELECT 1 FROM image_variants WHERE url = candidate.url)
+	`, fileURLs)
+	if err != nil {
+		log.Printf("Error checking uploaded files before removal: %v", err)
+		return
+	}
+	orphaned, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Printf("Error checking uploaded files before removal: %v", err)
+		return
+	}
+
+	for _, fileURL := range orphaned {
+		key, ok := storage.KeyFromURL(fileURL)
+		if !ok {
+			// Files hosted elsewhere are not ours to touch
+			continue
+		}
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			log.Printf("Error removing uploaded file %s: %v", key, err)
+		}
+	}
+}
+
+// GetAccountDeletionHandler reports whether the authenticated account is scheduled for deletion
+func GetAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var requestedAt, scheduledFor *time.Time
+	err := database.DBPool.QueryRow(ctx, `
+		SELECT deletion_requested_at, deletion_scheduled_for FROM users WHERE id = $1
+	`, user.ID).Scan(&requestedAt, &scheduledFor)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accountDeletionStatus(requestedAt, scheduledFor))
+}
+
+// RequestAccountDeletionHandler schedules the authenticated account for
+// deletion after accountDeletionGracePeriod. The user confirms with their
+// password and, when enabled, a two-factor code; wrong guesses count against
+// the login lockout.
+func RequestAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var passwordHash, username, email string
+	var twoFactorEnabled, scheduled bool
+	err = tx.QueryRow(ctx, `
+		SELECT password_hash, username, email, totp_enabled_at IS NOT NULL, deletion_scheduled_for IS NOT NULL
+		FROM users WHERE id = $1
+		FOR UPDATE
+	`, user.ID).Scan(&passwordHash, &username, &email, &twoFactorEnabled, &scheduled)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if scheduled {
+		http.Error(w, "Account deletion is already scheduled", http.StatusConflict)
+		return
+	}
+
+	clientIP := utils.ClientIP(r)
+	retryAfter, err := loginRetryAfter(ctx, email, clientIP)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyLoginAttempts(w, retryAfter)
+		return
+	}
+
+	// Accounts created through an identity provider have no password
+	if passwordHash != "" && bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)) != nil {
+		tx.Rollback(ctx)
+		recordLoginFailure(ctx, email, clientIP, &user.ID)
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	if twoFactorEnabled {
+		if req.Code == "" {
+			http.Error(w, "Authentication code is required", http.StatusBadRequest)
+			return
+		}
+		valid, err := verifySecondFactor(ctx, tx, user.ID, req.Code)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			tx.Rollback(ctx)
+			recordLoginFailure(ctx, email, clientIP, &user.ID)
+			http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var requestedAt, scheduledFor time.Time
+	err = tx.QueryRow(ctx, `
+		UPDATE users SET deletion_requested_at = NOW(), deletion_scheduled_for = NOW() + $2::interval
+		WHERE id = $1
+		RETURNING deletion_requested_at, deletion_scheduled_for
+	`, user.ID, intervalString(accountDeletionGracePeriod)).Scan(&requestedAt, &scheduledFor)
+	if err != nil {
+		http.Error(w, "Error scheduling account deletion", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error scheduling account deletion", http.StatusInternalServerError)
+		return
+	}
+
+	msg := mail.Message{
+		To:      email,
+		Subject: "Your Arouzy account will be deleted",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account and everything in it will be permanently deleted on %s.\n\n"+
+			"Changed your mind? Sign in and cancel the deletion from your settings before then:\n\n%s\n\n"+
+			"If you did not ask for this, sign in, cancel the deletion and change your password.\n",
+			username, scheduledFor.UTC().Format("January 2, 2006 15:04 MST"), utils.AppURL("/settings")),
+	}
+	go func() {
+		if err := mail.Send(msg); err != nil {
+			log.Printf("Error sending account deletion email to user %d: %v", user.ID, err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accountDeletionStatus(&requestedAt, &scheduledFor))
+}
+
+// CancelAccountDeletionHandler cancels a pending deletion of the authenticated account
+func CancelAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DBPool.Exec(ctx, `
+		UPDATE users SET deletion_requested_at = NULL, deletion_scheduled_for = NULL
+		WHERE id = $1 AND deletion_scheduled_for IS NOT NULL
+	`, user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		http.Error(w, "No account deletion is scheduled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account deletion cancelled"})
+}
+
+// accountDeletionStatus builds the API view of an account's deletion state
+func accountDeletionStatus(requestedAt, scheduledFor *time.Time) models.AccountDeletionStatus {
+	status := models.AccountDeletionStatus{Scheduled: scheduledFor != nil}
+	if requestedAt != nil {
+		status.RequestedAt = requestedAt.Format(time.RFC3339)
+	}
+	if scheduledFor != nil {
+		status.ScheduledFor = scheduledFor.Format(time.RFC3339)
+	}
+	return status
+}
+
+// RunAccountDeletions purges accounts whose deletion grace period has ended,
+// checking every accountDeletionCheckInterval until ctx is cancelled. Several
+// instances can run it at once; each account is purged by only one of them.
+func RunAccountDeletions(ctx context.Context) {
+	ticker := time.NewTicker(accountDeletionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			purged, err := purgeNextDueAccount(ctx)
+			if err != nil {
+				log.Printf("Error purging deleted account: %v", err)
+				break
+			}
+			if !purged {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeNextDueAccount purges one account whose grace period has ended and
+// reports whether there was one
+func purgeNextDueAccount(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Skip rows another instance is already purging
+	var userID int
+	err = tx.QueryRow(ctx, `
+		SELECT id FROM users
+		WHERE deletion_scheduled_for <= NOW()
+		ORDER BY deletion_scheduled_for
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	fileURLs, err := purgeUserTx(ctx, tx, userID)
+	if err != nil {
+		return false, fmt.Errorf("user %d: %v", userID, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("user %d: %v", userID, err)
+	}
+	middleware.SetSuspended(userID, true)
+	removeUploadedFiles(ctx, fileURLs)
+
+	log.Printf("Deleted account %d after its grace period", userID)
+	return true, nil
+}
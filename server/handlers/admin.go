@@ -0,0 +1,537 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/server/database"
+	"project/server/middleware"
+	"project/server/models"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// adminContentStatuses maps content moderation states to the admin panel's thread statuses
+var adminContentStatuses = map[string]string{
+	"approved": "active",
+	"pending":  "awaiting_moderation",
+	"removed":  "archived",
+}
+
+// GetAdminStatisticsHandler returns site-wide statistics for the admin dashboard
+func GetAdminStatisticsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var stats models.AdminStatistics
+	err := database.DBPool.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM users) AS total_users,
+			(SELECT COUNT(*) FROM users WHERE last_active_at >= NOW() - INTERVAL '30 days') AS active_users,
+			(SELECT COUNT(*) FROM users WHERE created_at >= NOW() - INTERVAL '30 days') AS new_signups,
+			(SELECT COUNT(*) FROM content) AS total_threads,
+			(SELECT COUNT(*) FROM comments WHERE deleted_at IS NULL) AS total_posts,
+			(SELECT COUNT(*) FROM content WHERE moderation_status = 'pending') AS pending_moderation
+	`).Scan(
+		&stats.TotalUsers,
+		&stats.ActiveUsers30Days,
+		&stats.NewSignups30Days,
+		&stats.TotalThreads,
+		&stats.TotalPosts,
+		&stats.PendingModeration,
+	)
+	if err != nil {
+		log.Printf("Error fetching admin statistics: %v", err)
+		http.Error(w, "Error fetching statistics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// ListAdminUsersHandler lists users for the admin panel, optionally searching by username or email
+func ListAdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+
+	page, err := strconv.Atoi(queryParams.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit := parsePageSize(queryParams.Get("limit"))
+	offset := (page - 1) * limit
+
+	whereClause := "WHERE 1=1 "
+	args := []interface{}{}
+	argPosition := 1
+
+	if search := strings.TrimSpace(queryParams.Get("q")); search != "" {
+		whereClause += fmt.Sprintf("AND (u.username ILIKE $%d OR u.email ILIKE $%d) ", argPosition, argPosition)
+		args = append(args, "%"+search+"%")
+		argPosition++
+	}
+
+	if role := queryParams.Get("role"); role != "" {
+		whereClause += fmt.Sprintf("AND u.role = $%d ", argPosition)
+		args = append(args, role)
+		argPosition++
+	}
+
+	if queryParams.Get("suspended") == "true" {
+		whereClause += "AND u.suspended_at IS NOT NULL "
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT u.id, u.username, u.email, u.role, u.created_at, u.last_active_at,
+		       u.suspended_at, COALESCE(u.suspension_reason, ''),
+		       (SELECT COUNT(*) FROM content c WHERE c.user_id = u.id) AS posts_count
+		FROM users u
+		`+whereClause+`
+		ORDER BY u.created_at DESC, u.id DESC
+		`+fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset),
+		args...)
+	if err != nil {
+		log.Printf("Error querying users: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := []models.AdminUser{}
+	for rows.Next() {
+		var user models.AdminUser
+		var createdAt time.Time
+		var lastActiveAt, suspendedAt *time.Time
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.Usergroup,
+			&createdAt,
+			&lastActiveAt,
+			&suspendedAt,
+			&user.SuspensionReason,
+			&user.PostsCount,
+		)
+		if err != nil {
+			http.Error(w, "Error parsing users", http.StatusInternalServerError)
+			return
+		}
+		user.JoinDate = createdAt.Format(time.RFC3339)
+		if lastActiveAt != nil {
+			user.LastActive = lastActiveAt.Format(time.RFC3339)
+		}
+		if suspendedAt != nil {
+			user.SuspendedAt = suspendedAt.Format(time.RFC3339)
+		}
+		users = append(users, user)
+	}
+
+	var totalItems int
+	err = database.DBPool.QueryRow(ctx, "SELECT COUNT(*) FROM users u "+whereClause, args...).Scan(&totalItems)
+	if err != nil {
+		http.Error(w, "Error counting users", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.AdminUserResponse{
+		Users: users,
+		Pagination: models.Pagination{
+			CurrentPage:  page,
+			TotalPages:   (totalItems + limit - 1) / limit,
+			TotalItems:   totalItems,
+			ItemsPerPage: limit,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// SuspendUserHandler blocks a user from signing in or using their existing tokens
+func SuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if userID == admin.ID {
+		http.Error(w, "Cannot suspend yourself", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SuspendUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DBPool.Exec(ctx, `
+		UPDATE users SET suspended_at = NOW(), suspension_reason = $1, updated_at = NOW()
+		WHERE id = $2
+	`, req.Reason, userID)
+	if err != nil {
+		log.Printf("Error suspending user: %v", err)
+		http.Error(w, "Error suspending user", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	middleware.SetSuspended(userID, true)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User suspended"})
+}
+
+// UnsuspendUserHandler lifts a user's suspension
+func UnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DBPool.Exec(ctx, `
+		UPDATE users SET suspended_at = NULL, suspension_reason = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		log.Printf("Error unsuspending user: %v", err)
+		http.Error(w, "Error unsuspending user", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	middleware.SetSuspended(userID, false)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User unsuspended"})
+}
+
+// AdminDeleteUserHandler permanently deletes a user and everything they own
+func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if userID == admin.ID {
+		http.Error(w, "Cannot delete yourself", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the user row so concurrent requests cannot add rows while it is purged
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT true FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	fileURLs, err := purgeUserTx(ctx, tx, userID)
+	if err != nil {
+		log.Printf("Error deleting user %d: %v", userID, err)
+		http.Error(w, "Error deleting user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error finalizing user deletion", http.StatusInternalServerError)
+		return
+	}
+	middleware.SetSuspended(userID, true)
+	removeUploadedFiles(ctx, fileURLs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
+}
+
+// ListAdminContentHandler lists content (threads) for the admin panel with moderation state
+func ListAdminContentHandler(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+
+	page, err := strconv.Atoi(queryParams.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit := parsePageSize(queryParams.Get("limit"))
+	offset := (page - 1) * limit
+
+	whereClause := "WHERE 1=1 "
+	args := []interface{}{}
+	argPosition := 1
+
+	if search := strings.TrimSpace(queryParams.Get("q")); search != "" {
+		whereClause += fmt.Sprintf("AND (c.title ILIKE $%d OR u.username ILIKE $%d) ", argPosition, argPosition)
+		args = append(args, "%"+search+"%")
+		argPosition++
+	}
+
+	// Accept either panel statuses or moderation states
+	if status := queryParams.Get("status"); status != "" {
+		for moderationStatus, panelStatus := range adminContentStatuses {
+			if status == panelStatus {
+				status = moderationStatus
+			}
+		}
+		whereClause += fmt.Sprintf("AND c.moderation_status = $%d ", argPosition)
+		args = append(args, status)
+		argPosition++
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT c.id, c.title, COALESCE(u.username, ''), c.image_count, c.video_count,
+		       c.created_at, c.moderation_status, c.comment_count
+		FROM content c
+		LEFT JOIN users u ON c.user_id = u.id
+		`+whereClause+`
+		ORDER BY c.created_at DESC, c.id DESC
+		`+fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset),
+		args...)
+	if err != nil {
+		log.Printf("Error querying content: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	threads := []models.AdminContent{}
+	for rows.Next() {
+		var thread models.AdminContent
+		var createdAt time.Time
+		var moderationStatus string
+		err := rows.Scan(
+			&thread.ID,
+			&thread.Title,
+			&thread.Author,
+			&thread.Photos,
+			&thread.Videos,
+			&createdAt,
+			&moderationStatus,
+			&thread.Replies,
+		)
+		if err != nil {
+			http.Error(w, "Error parsing content", http.StatusInternalServerError)
+			return
+		}
+		thread.DatePosted = createdAt.Format(time.RFC3339)
+		thread.Status = adminContentStatuses[moderationStatus]
+		threads = append(threads, thread)
+	}
+
+	var totalItems int
+	err = database.DBPool.QueryRow(ctx,
+		"SELECT COUNT(*) FROM content c LEFT JOIN users u ON c.user_id = u.id "+whereClause,
+		args...).Scan(&totalItems)
+	if err != nil {
+		http.Error(w, "Error counting content", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.AdminContentResponse{
+		Threads: threads,
+		Pagination: models.Pagination{
+			CurrentPage:  page,
+			TotalPages:   (totalItems + limit - 1) / limit,
+			TotalItems:   totalItems,
+			ItemsPerPage: limit,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminDeleteContentHandler deletes any content item regardless of owner
+func AdminDeleteContentHandler(w http.ResponseWriter, r *http.Request) {
+	contentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT true FROM content WHERE id = $1 FOR UPDATE`, contentID).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Content not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	fileURLs, err := deleteContentTx(ctx, tx, contentID)
+	if err != nil {
+		log.Printf("Error deleting content %d: %v", contentID, err)
+		http.Error(w, "Error deleting content", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error finalizing content deletion", http.StatusInternalServerError)
+		return
+	}
+	removeUploadedFiles(ctx, fileURLs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Content deleted successfully"})
+}
+
+// ListAttackedAccountsHandler lists accounts with failed logins in the last
+// "hours" hours (default 24), most attacked first
+func ListAttackedAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	hours, err := strconv.Atoi(r.URL.Query().Get("hours"))
+	if err != nil || hours < 1 {
+		hours = 24
+	}
+	if hours > 24*30 {
+		hours = 24 * 30 // events are only kept for 30 days
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT u.id, u.username, u.email,
+		       COUNT(*) FILTER (WHERE e.event_type = 'failure') AS failures,
+		       COUNT(*) FILTER (WHERE e.event_type = 'lockout') AS lockouts,
+		       COUNT(DISTINCT e.ip_address) AS distinct_ips,
+		       MAX(e.created_at) AS last_failure_at,
+		       (SELECT t.locked_until FROM login_throttles t
+		        WHERE t.key = 'account:' || LOWER(u.email) AND t.locked_until > NOW()) AS locked_until
+		FROM login_events e
+		JOIN users u ON u.id = e.user_id
+		WHERE e.created_at >= $1
+		GROUP BY u.id
+		ORDER BY failures DESC, last_failure_at DESC
+		LIMIT 100
+	`, since)
+	if err != nil {
+		log.Printf("Error querying attacked accounts: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	accounts := []models.AttackedAccount{}
+	for rows.Next() {
+		var account models.AttackedAccount
+		var lastFailureAt time.Time
+		var lockedUntil *time.Time
+		err := rows.Scan(
+			&account.UserID,
+			&account.Username,
+			&account.Email,
+			&account.Failures,
+			&account.Lockouts,
+			&account.DistinctIPs,
+			&lastFailureAt,
+			&lockedUntil,
+		)
+		if err != nil {
+			http.Error(w, "Error parsing accounts", http.StatusInternalServerError)
+			return
+		}
+		account.LastFailureAt = lastFailureAt.Format(time.RFC3339)
+		if lockedUntil != nil {
+			account.LockedUntil = lockedUntil.Format(time.RFC3339)
+		}
+		accounts = append(accounts, account)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.AttackedAccountsResponse{
+		Accounts: accounts,
+		Since:    since.Format(time.RFC3339),
+	})
+}
+
+// UnlockUserLoginHandler lifts a login lockout on an account
+func UnlockUserLoginHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var email string
+	err = database.DBPool.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	clearAccountThrottle(ctx, email)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Login lockout cleared"})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/server/database"
+	"project/server/models"
+	"project/server/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxAPITokensPerUser caps how many active personal access tokens an account can hold
+	maxAPITokensPerUser = 50
+	// maxAPITokenExpiryDays is the longest expiry that can be requested for a token
+	maxAPITokenExpiryDays = 365
+	// apiTokenPrefixLength is how much of a token is kept in clear to identify it in listings
+	apiTokenPrefixLength = 12
+)
+
+// ListAPITokensHandler lists the authenticated user's personal access tokens
+func ListAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT id, name, token_prefix, scopes, created_at, expires_at, last_used_at
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC, id DESC
+	`, user.ID)
+	if err != nil {
+		log.Printf("Error listing API tokens: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		var token models.APIToken
+		var createdAt time.Time
+		var expiresAt, lastUsedAt *time.Time
+		if err := rows.Scan(&token.ID, &token.Name, &token.Prefix, &token.Scopes, &createdAt, &expiresAt, &lastUsedAt); err != nil {
+			http.Error(w, "Error parsing API tokens", http.StatusInternalServerError)
+			return
+		}
+		token.CreatedAt = createdAt.Format(time.RFC3339)
+		if expiresAt != nil {
+			token.ExpiresAt = expiresAt.Format(time.RFC3339)
+		}
+		if lastUsedAt != nil {
+			token.LastUsedAt = lastUsedAt.Format(time.RFC3339)
+		}
+		tokens = append(tokens, token)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens})
+}
+
+// CreateAPITokenHandler creates a personal access token for the authenticated
+// user. The token itself is only returned in this response.
+func CreateAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req models.CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPITokenExpiryDays {
+		http.Error(w, fmt.Sprintf("expiresInDays must be between 0 and %d", maxAPITokenExpiryDays), http.StatusBadRequest)
+		return
+	}
+
+	scopes, err := normalizeTokenScopes(req.Scopes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var active int
+	err = database.DBPool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, user.ID).Scan(&active)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if active >= maxAPITokensPerUser {
+		http.Error(w, fmt.Sprintf("You can have at most %d active API tokens", maxAPITokensPerUser), http.StatusBadRequest)
+		return
+	}
+
+	plain, err := utils.GenerateAPIToken()
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token := models.APIToken{Name: req.Name, Prefix: plain[:apiTokenPrefixLength], Scopes: scopes}
+	var createdAt time.Time
+	err = database.DBPool.QueryRow(ctx, `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, user.ID, token.Name, utils.HashToken(plain), token.Prefix, token.Scopes, expiresAt).Scan(&token.ID, &createdAt)
+	if err != nil {
+		log.Printf("Error creating API token: %v", err)
+		http.Error(w, "Error creating token", http.StatusInternalServerError)
+		return
+	}
+	token.CreatedAt = createdAt.Format(time.RFC3339)
+	if expiresAt != nil {
+		token.ExpiresAt = expiresAt.Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.CreateAPITokenResponse{Token: plain, APIToken: token})
+}
+
+// RevokeAPITokenHandler revokes one of the authenticated user's personal access tokens
+func RevokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	tokenID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DBPool.Exec(ctx, `
+		UPDATE personal_access_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, tokenID, user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Token revoked"})
+}
+
+// normalizeTokenScopes validates requested scopes and removes duplicates
+func normalizeTokenScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("At least one scope is required (%s)", strings.Join(models.APITokenScopes, ", "))
+	}
+
+	seen := map[string]bool{}
+	scopes := []string{}
+	for _, scope := range requested {
+		valid := false
+		for _, known := range models.APITokenScopes {
+			if scope == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("Unknown scope %q", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
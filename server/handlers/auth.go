@@ -3,7 +3,10 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/mail"
+	"strings"
 	"time"
 
 	"project/server/database"
@@ -13,6 +16,24 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// maxEmailLength matches users.email
+const maxEmailLength = 255
+
+// normalizeEmail checks that raw is a bare email address, without a display
+// name or angle brackets, and returns it in lower case. Addresses are compared
+// case-insensitively everywhere, so one mailbox cannot hold two accounts.
+func normalizeEmail(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > maxEmailLength {
+		return "", false
+	}
+	addr, err := mail.ParseAddress(raw)
+	if err != nil || addr.Name != "" || addr.Address != raw {
+		return "", false
+	}
+	return strings.ToLower(addr.Address), true
+}
+
 // SignupHandler handles user registration
 func SignupHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
@@ -27,6 +48,12 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Username, email and password are required", http.StatusBadRequest)
 		return
 	}
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	req.Email = email
 
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
@@ -35,7 +62,7 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if username or email already exists
 	var existingCount int
 	err := database.DBPool.QueryRow(ctx,
-		"SELECT COUNT(*) FROM users WHERE username = $1 OR email = $2",
+		"SELECT COUNT(*) FROM users WHERE username = $1 OR LOWER(email) = $2",
 		req.Username, req.Email,
 	).Scan(&existingCount)
 
@@ -59,7 +86,7 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 	// Insert user into database
 	var userID int
 	err = database.DBPool.QueryRow(ctx,
-		"INSERT INTO users (username, email, password_hash) VALUES ($1, $2, $3) RETURNING id",
+		"INSERT INTO users (username, email, password_hash, verification_sent_at) VALUES ($1, $2, $3, NOW()) RETURNING id",
 		req.Username, req.Email, string(hashedPassword),
 	).Scan(&userID)
 
@@ -69,25 +96,27 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create user object for response
+	verified := false
 	user := models.User{
-		ID:       userID,
-		Username: req.Username,
-		Email:    req.Email,
+		ID:            userID,
+		Username:      req.Username,
+		Email:         req.Email,
+		Role:          models.RoleUser,
+		EmailVerified: &verified,
+	}
+
+	// Ask the user to confirm their email address
+	if err := sendVerificationEmail(user.ID, user.Username, user.Email); err != nil {
+		log.Printf("Error creating verification link for user %d: %v", user.ID, err)
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user)
+	// Generate access and refresh tokens
+	resp, err := startSession(ctx, r, user)
 	if err != nil {
 		http.Error(w, "Error generating authentication token", http.StatusInternalServerError)
 		return
 	}
 
-	// Return successful response
-	resp := models.AuthResponse{
-		Token: token,
-		User:  user,
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(resp)
@@ -112,16 +141,30 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	// Refuse to check passwords while the account or address is locked out
+	clientIP := utils.ClientIP(r)
+	retryAfter, err := loginRetryAfter(ctx, req.Email, clientIP)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyLoginAttempts(w, retryAfter)
+		return
+	}
+
 	// Retrieve user from database
 	var user models.User
 	var passwordHash string
+	var suspended, verified, twoFactor bool
 
-	err := database.DBPool.QueryRow(ctx,
-		"SELECT id, username, email, password_hash FROM users WHERE email = $1",
-		req.Email,
-	).Scan(&user.ID, &user.Username, &user.Email, &passwordHash)
+	err = database.DBPool.QueryRow(ctx,
+		"SELECT id, username, email, role, password_hash, suspended_at IS NOT NULL, verified_at IS NOT NULL, totp_enabled_at IS NOT NULL FROM users WHERE LOWER(email) = LOWER($1)",
+		strings.TrimSpace(req.Email),
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &passwordHash, &suspended, &verified, &twoFactor)
 
 	if err != nil {
+		recordLoginFailure(ctx, req.Email, clientIP, nil)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
@@ -129,21 +172,31 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password))
 	if err != nil {
+		recordLoginFailure(ctx, req.Email, clientIP, &user.ID)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user)
-	if err != nil {
-		http.Error(w, "Error generating authentication token", http.StatusInternalServerError)
+	// Suspended accounts cannot sign in
+	if suspended {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	// Accounts with two-factor enabled finish logging in at /auth/login/2fa
+	if twoFactor {
+		writeLoginChallenge(w, user.ID)
 		return
 	}
 
-	// Return successful response
-	resp := models.AuthResponse{
-		Token: token,
-		User:  user,
+	user.EmailVerified = &verified
+	clearAccountThrottle(ctx, req.Email)
+
+	// Generate access and refresh tokens
+	resp, err := startSession(ctx, r, user)
+	if err != nil {
+		http.Error(w, "Error generating authentication token", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -159,6 +212,20 @@ func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Verification state is not carried in the token, so read it fresh
+	var verified bool
+	err := database.DBPool.QueryRow(ctx,
+		"SELECT verified_at IS NOT NULL FROM users WHERE id = $1", user.ID,
+	).Scan(&verified)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	user.EmailVerified = &verified
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"plain", "user@example.com", "user@example.com", true},
+		{"upper case", "User@Example.COM", "user@example.com", true},
+		{"surrounding space", "  user@example.com\n", "user@example.com", true},
+		{"plus tag", "user+tag@example.com", "user+tag@example.com", true},
+		{"display name", "User <user@example.com>", "", false},
+		{"angle brackets", "<user@example.com>", "", false},
+		{"two addresses", "a@example.com, b@example.com", "", false},
+		{"no domain", "user@", "", false},
+		{"no at", "user.example.com", "", false},
+		{"header injection", "user@example.com\r\nBcc: other@example.com", "", false},
+		{"too long", strings.Repeat("a", 250) + "@example.com", "", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := normalizeEmail(tt.raw)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("normalizeEmail(%q) = %q, %v, want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -227,15 +227,16 @@ func GetCollectionContentHandler(w http.ResponseWriter, r *http.Request) {
 	// Get content from collection
 	rows, err := database.DBPool.Query(ctx, `
 		SELECT c.id, c.user_id, c.title, c.description, c.image_count, c.video_count, 
-		       c.thumbnail_url, c.created_at, cc.added_at,
+		       `+contentThumbnailSQL+`, c.created_at, cc.added_at,
 		       u.username,
-		       (SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) as upvotes
+		       c.upvote_count as upvotes, c.comment_count,
+		       EXISTS(SELECT 1 FROM upvotes WHERE content_id = c.id AND user_id = $2) AS has_upvoted
 		FROM collection_content cc
 		JOIN content c ON cc.content_id = c.id
 		JOIN users u ON c.user_id = u.id
-		WHERE cc.collection_id = $1
+		WHERE cc.collection_id = $1 AND c.moderation_status = 'approved'
 		ORDER BY cc.added_at DESC
-	`, collectionID)
+	`, collectionID, currentUser.ID)
 	if err != nil {
 		log.Printf("Error querying collection content: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
@@ -260,6 +261,8 @@ func GetCollectionContentHandler(w http.ResponseWriter, r *http.Request) {
 			&addedAt,
 			&username,
 			&item.Upvotes,
+			&item.CommentCount,
+			&item.HasUpvoted,
 		)
 		if err != nil {
 			log.Printf("Error scanning content item: %v", err)
@@ -311,11 +314,11 @@ func SaveToCollectionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if content exists
+	// Check if content exists; content not yet approved is only visible to its author
 	var contentExists bool
 	err = database.DBPool.QueryRow(ctx, `
-		SELECT EXISTS(SELECT 1 FROM content WHERE id = $1)
-	`, req.ContentID).Scan(&contentExists)
+		SELECT EXISTS(SELECT 1 FROM content WHERE id = $1 AND (moderation_status = 'approved' OR user_id = $2))
+	`, req.ContentID, user.ID).Scan(&contentExists)
 	if err != nil || !contentExists {
 		http.Error(w, "Content not found", http.StatusNotFound)
 		return
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/server/database"
+	"project/server/models"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxCommentLength caps the number of characters in a comment body
+const maxCommentLength = 5000
+
+// ListContentCommentsHandler lists the top-level comments on a content item
+func ListContentCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	contentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		return
+	}
+
+	// User ID 0 never matches an author
+	var viewerID int
+	if viewer, ok := r.Context().Value(models.UserContextKey).(models.User); ok {
+		viewerID = viewer.ID
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Check if content exists; content not yet approved is only visible to its author
+	var contentExists bool
+	err = database.DBPool.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM content WHERE id = $1 AND (moderation_status = 'approved' OR user_id = $2))
+	`, contentID, viewerID).Scan(&contentExists)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !contentExists {
+		http.Error(w, "Content not found", http.StatusNotFound)
+		return
+	}
+
+	serveCommentPage(ctx, w, r, "cm.content_id = $1 AND cm.parent_id IS NULL", contentID)
+}
+
+// ListCommentRepliesHandler lists the direct replies to a comment
+func ListCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	commentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	var viewerID int
+	if viewer, ok := r.Context().Value(models.UserContextKey).(models.User); ok {
+		viewerID = viewer.ID
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Check if comment exists on content the viewer can see
+	var commentExists bool
+	err = database.DBPool.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM comments cm JOIN content c ON c.id = cm.content_id
+			WHERE cm.id = $1 AND (c.moderation_status = 'approved' OR c.user_id = $2)
+		)
+	`, commentID, viewerID).Scan(&commentExists)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !commentExists {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	serveCommentPage(ctx, w, r, "cm.parent_id = $1", commentID)
+}
+
+// CreateCommentHandler adds a comment to a content item, or a reply when parentId is set
+func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	contentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	body, ok := validateCommentBody(w, req.Body)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Check if content exists; content not yet approved is only visible to its author
+	var contentExists bool
+	err = database.DBPool.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM content WHERE id = $1 AND (moderation_status = 'approved' OR user_id = $2))
+	`, contentID, user.ID).Scan(&contentExists)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !contentExists {
+		http.Error(w, "Content not found", http.StatusNotFound)
+		return
+	}
+
+	// Replies must target a live comment on the same content
+	if req.ParentID != nil {
+		var parentExists bool
+		err = database.DBPool.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND content_id = $2 AND deleted_at IS NULL)
+		`, *req.ParentID, contentID).Scan(&parentExists)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !parentExists {
+			http.Error(w, "Parent comment not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	comment := models.Comment{
+		ContentID: contentID,
+		ParentID:  req.ParentID,
+		User:      models.User{ID: user.ID, Username: user.Username},
+		Body:      body,
+	}
+	var createdAt time.Time
+	err = database.DBPool.QueryRow(ctx, `
+		INSERT INTO comments (content_id, user_id, parent_id, body)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at
+	`, contentID, user.ID, req.ParentID, body).Scan(&comment.ID, &createdAt)
+	if err != nil {
+		log.Printf("Error creating comment: %v", err)
+		http.Error(w, "Error creating comment", http.StatusInternalServerError)
+		return
+	}
+	comment.CreatedAt = createdAt.Format(time.RFC3339)
+	comment.UpdatedAt = comment.CreatedAt
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// UpdateCommentHandler edits the body of a comment written by the caller
+func UpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	commentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	body, ok := validateCommentBody(w, req.Body)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Check if comment belongs to user
+	var authorID *int
+	var isDeleted bool
+	err = database.DBPool.QueryRow(ctx, `
+		SELECT user_id, deleted_at IS NOT NULL FROM comments WHERE id = $1
+	`, commentID).Scan(&authorID, &isDeleted)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if isDeleted {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	if authorID == nil || *authorID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	_, err = database.DBPool.Exec(ctx, `
+		UPDATE comments SET body = $1, updated_at = NOW() WHERE id = $2
+	`, body, commentID)
+	if err != nil {
+		log.Printf("Error updating comment: %v", err)
+		http.Error(w, "Error updating comment", http.StatusInternalServerError)
+		return
+	}
+
+	comment, err := getComment(ctx, commentID)
+	if err != nil {
+		http.Error(w, "Error fetching comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteCommentHandler removes a comment; allowed for its author and the content owner.
+// The row is kept as a tombstone so replies remain in the thread.
+func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	commentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Look up the comment author and the owner of the content it belongs to
+	var authorID, contentOwnerID *int
+	var isDeleted bool
+	err = database.DBPool.QueryRow(ctx, `
+		SELECT cm.user_id, c.user_id, cm.deleted_at IS NOT NULL
+		FROM comments cm
+		JOIN content c ON cm.content_id = c.id
+		WHERE cm.id = $1
+	`, commentID).Scan(&authorID, &contentOwnerID, &isDeleted)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if isDeleted {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	isAuthor := authorID != nil && *authorID == user.ID
+	isContentOwner := contentOwnerID != nil && *contentOwnerID == user.ID
+	if !isAuthor && !isContentOwner {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	_, err = database.DBPool.Exec(ctx, `
+		UPDATE comments SET body = '', deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, commentID)
+	if err != nil {
+		log.Printf("Error deleting comment: %v", err)
+		http.Error(w, "Error deleting comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted successfully"})
+}
+
+// validateCommentBody trims and checks a comment body, writing the error response when invalid
+func validateCommentBody(w http.ResponseWriter, body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		http.Error(w, "Comment body is required", http.StatusBadRequest)
+		return "", false
+	}
+	if len([]rune(body)) > maxCommentLength {
+		http.Error(w, "Comment is too long", http.StatusBadRequest)
+		return "", false
+	}
+	return body, true
+}
+
+// commentColumns selects a comment with its author and reply count; deleted
+// comments come back without body or author
+const commentColumns = `
+	cm.id, cm.content_id, cm.parent_id,
+	CASE WHEN cm.deleted_at IS NULL THEN cm.body ELSE '' END,
+	cm.deleted_at IS NOT NULL,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_id = cm.id) AS reply_count,
+	cm.created_at, cm.updated_at,
+	CASE WHEN cm.deleted_at IS NULL THEN COALESCE(u.id, 0) ELSE 0 END,
+	CASE WHEN cm.deleted_at IS NULL THEN COALESCE(u.username, '') ELSE '' END
+`
+
+// scanComment reads a row selected with commentColumns
+func scanComment(row pgx.Row) (models.Comment, error) {
+	var comment models.Comment
+	var createdAt, updatedAt time.Time
+	err := row.Scan(
+		&comment.ID,
+		&comment.ContentID,
+		&comment.ParentID,
+		&comment.Body,
+		&comment.IsDeleted,
+		&comment.ReplyCount,
+		&createdAt,
+		&updatedAt,
+		&comment.User.ID,
+		&comment.User.Username,
+	)
+	if err != nil {
+		return comment, err
+	}
+	comment.CreatedAt = createdAt.Format(time.RFC3339)
+	comment.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return comment, nil
+}
+
+// getComment loads a single comment by ID
+func getComment(ctx context.Context, commentID int) (models.Comment, error) {
+	row := database.DBPool.QueryRow(ctx, `
+		SELECT `+commentColumns+`
+		FROM comments cm
+		LEFT JOIN users u ON cm.user_id = u.id
+		WHERE cm.id = $1
+	`, commentID)
+	return scanComment(row)
+}
+
+// serveCommentPage writes one page of the comments matching where, oldest first.
+// where may reference a single placeholder $1 bound to id.
+func serveCommentPage(ctx context.Context, w http.ResponseWriter, r *http.Request, where string, id int) {
+	queryParams := r.URL.Query()
+
+	page, err := strconv.Atoi(queryParams.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit := parsePageSize(queryParams.Get("limit"))
+	offset := (page - 1) * limit
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT `+commentColumns+`
+		FROM comments cm
+		LEFT JOIN users u ON cm.user_id = u.id
+		WHERE `+where+`
+		ORDER BY cm.created_at ASC, cm.id ASC
+		LIMIT $2 OFFSET $3
+	`, id, limit, offset)
+	if err != nil {
+		log.Printf("Error querying comments: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	comments := []models.Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			http.Error(w, "Error parsing comments", http.StatusInternalServerError)
+			return
+		}
+		comments = append(comments, comment)
+	}
+
+	var totalItems int
+	err = database.DBPool.QueryRow(ctx, `SELECT COUNT(*) FROM comments cm WHERE `+where, id).Scan(&totalItems)
+	if err != nil {
+		http.Error(w, "Error counting comments", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.CommentResponse{
+		Comments: comments,
+		Pagination: models.Pagination{
+			CurrentPage:  page,
+			TotalPages:   (totalItems + limit - 1) / limit,
+			TotalItems:   totalItems,
+			ItemsPerPage: limit,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
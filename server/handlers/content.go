@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -19,6 +20,13 @@ import (
 
 // GetContentHandler retrieves content with pagination and filters
 func GetContentHandler(w http.ResponseWriter, r *http.Request) {
+	serveContentList(w, r, "WHERE c.moderation_status = 'approved' ", nil)
+}
+
+// serveContentList writes a content listing restricted by baseWhere, applying the
+// sort, filter and pagination query parameters shared by content listings.
+// baseWhere must start with "WHERE" and use placeholders $1..$n for baseArgs.
+func serveContentList(w http.ResponseWriter, r *http.Request, baseWhere string, baseArgs []interface{}) {
 	// Parse query parameters
 	queryParams := r.URL.Query()
 
@@ -28,24 +36,36 @@ func GetContentHandler(w http.ResponseWriter, r *http.Request) {
 		page = 1
 	}
 
-	limit := 20
+	limit := parsePageSize(queryParams.Get("limit"))
 	offset := (page - 1) * limit
 
 	// Sort parameter
 	sort := queryParams.Get("sort")
-	if sort == "" {
+	switch sort {
+	case "":
 		sort = "hot" // Default sort
+	case "new", "top", "hot", "shuffle":
+	default:
+		sort = "new"
 	}
 
-	// Build the query
-	query := "SELECT c.id, c.title, c.image_count, c.video_count, c.thumbnail_url, c.created_at, " +
-		"(SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) AS upvotes " +
-		"FROM content c "
+	// Cursor parameter (takes precedence over page)
+	var cursor *feedCursor
+	if rawCursor := queryParams.Get("cursor"); rawCursor != "" {
+		c, err := decodeFeedCursor(rawCursor)
+		if err != nil || c.Sort != sort {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = &c
+		page = 1
+		offset = 0
+	}
 
 	// Build the WHERE clause based on filters
-	whereClause := "WHERE 1=1 "
-	args := []interface{}{}
-	argPosition := 1
+	whereClause := baseWhere
+	args := append([]interface{}{}, baseArgs...)
+	argPosition := len(args) + 1
 
 	// Filter by author username
 	if username := queryParams.Get("username"); username != "" {
@@ -65,7 +85,7 @@ func GetContentHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Filter by minimum upvotes
 	if minUpvotes, err := strconv.Atoi(queryParams.Get("minUpvotes")); err == nil && minUpvotes > 0 {
-		whereClause += fmt.Sprintf("AND (SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) >= $%d ", argPosition)
+		whereClause += fmt.Sprintf("AND c.upvote_count >= $%d ", argPosition)
 		args = append(args, minUpvotes)
 		argPosition++
 	}
@@ -97,34 +117,54 @@ func GetContentHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Add ORDER BY based on sort parameter
-	orderClause := "ORDER BY "
-	switch sort {
-	case "new":
-		orderClause += "c.created_at DESC "
-	case "top":
-		orderClause += "(SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) DESC, c.created_at DESC "
-	case "hot":
-		// Hot algorithm: Upvotes combined with recency
-		orderClause += "(SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) * (1.0 / (EXTRACT(EPOCH FROM (NOW() - c.created_at))/86400 + 2)^1.5) DESC "
-	case "shuffle":
-		orderClause += "RANDOM() "
-	default:
-		orderClause += "c.created_at DESC "
+	// Arguments after this point are only used by the listing query, not the count
+	selectArgs := append([]interface{}{}, args...)
+	selectWhereClause := whereClause
+
+	// Hot scores are computed relative to a fixed time so they stay stable across cursor pages
+	asOf := time.Now()
+	if cursor != nil && cursor.Sort == "hot" {
+		asOf = cursorAsOf(*cursor)
+	}
+	feedOrder := contentFeedSort(sort, fmt.Sprintf("$%d", argPosition))
+	if sort == "hot" {
+		selectArgs = append(selectArgs, asOf)
+		argPosition++
 	}
 
-	// Add pagination
-	limitClause := fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+	// Resume after the cursor item
+	if cursor != nil {
+		selectWhereClause += fmt.Sprintf("AND (%s, c.id) < ($%d::%s, $%d) ", feedOrder.valueExpr, argPosition, feedOrder.valueType, argPosition+1)
+		selectArgs = append(selectArgs, cursor.Value, cursor.ID)
+		argPosition += 2
+	}
+
+	// Add pagination (one extra row tells us whether another page exists)
+	limitClause := fmt.Sprintf("LIMIT %d OFFSET %d", limit+1, offset)
+
+	// Flag items the calling user has upvoted (user ID 0 never matches)
+	var currentUserID int
+	if currentUser, ok := r.Context().Value(models.UserContextKey).(models.User); ok {
+		currentUserID = currentUser.ID
+	}
+	selectArgs = append(selectArgs, currentUserID)
+
+	// Build the query
+	query := "SELECT c.id, c.title, c.image_count, c.video_count, " + contentThumbnailSQL + ", c.created_at, " +
+		"c.upvote_count AS upvotes, c.comment_count, " +
+		fmt.Sprintf("EXISTS(SELECT 1 FROM upvotes WHERE content_id = c.id AND user_id = $%d) AS has_upvoted, ", argPosition) +
+		fmt.Sprintf("(%s)::text AS sort_value ", feedOrder.valueExpr) +
+		"FROM content c "
 
 	// Complete query
-	fullQuery := query + whereClause + orderClause + limitClause
+	fullQuery := query + selectWhereClause + feedOrder.orderClause + limitClause
 
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
 	// Execute query
-	rows, err := database.DBPool.Query(ctx, fullQuery, args...)
+	rows, err := database.DBPool.Query(ctx, fullQuery, selectArgs...)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
@@ -133,9 +173,11 @@ func GetContentHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Parse results
 	contentItems := []models.ContentItem{}
+	sortValues := []string{}
 	for rows.Next() {
 		var item models.ContentItem
 		var createdAt time.Time
+		var sortValue string
 
 		err := rows.Scan(
 			&item.ID,
@@ -145,6 +187,9 @@ func GetContentHandler(w http.ResponseWriter, r *http.Request) {
 			&item.Thumbnail,
 			&createdAt,
 			&item.Upvotes,
+			&item.CommentCount,
+			&item.HasUpvoted,
+			&sortValue,
 		)
 
 		if err != nil {
@@ -172,33 +217,50 @@ func GetContentHandler(w http.ResponseWriter, r *http.Request) {
 					images = append(images, image)
 				}
 			}
+			attachImageVariants(ctx, images)
 			item.Images = images
 		}
 		
 		contentItems = append(contentItems, item)
+		sortValues = append(sortValues, sortValue)
 	}
 
-	// Count total items for pagination
-	countQuery := "SELECT COUNT(*) FROM content c " + whereClause
-	var totalItems int
-
-	err = database.DBPool.QueryRow(ctx, countQuery, args...).Scan(&totalItems)
-	if err != nil {
-		http.Error(w, "Error counting total items", http.StatusInternalServerError)
-		return
+	// Drop the lookahead row and point the next cursor at the last item kept
+	hasMore := len(contentItems) > limit
+	if hasMore {
+		contentItems = contentItems[:limit]
+	}
+	var nextCursor string
+	if hasMore && feedOrder.cursorable {
+		last := feedCursor{Sort: sort, Value: sortValues[limit-1], ID: contentItems[limit-1].ID}
+		if sort == "hot" {
+			last.AsOf = asOf.UnixMicro()
+		}
+		nextCursor = encodeFeedCursor(last)
 	}
-
-	totalPages := (totalItems + limit - 1) / limit
 
 	// Build response
 	response := models.ContentResponse{
-		Content: contentItems,
-		Pagination: models.Pagination{
-			CurrentPage:  page,
-			TotalPages:   totalPages,
-			TotalItems:   totalItems,
-			ItemsPerPage: limit,
-		},
+		Content:    contentItems,
+		Pagination: models.Pagination{ItemsPerPage: limit},
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
+	}
+
+	// Totals are only counted for page-based requests; cursor clients page with hasMore
+	if cursor == nil {
+		countQuery := "SELECT COUNT(*) FROM content c " + whereClause
+		var totalItems int
+
+		err = database.DBPool.QueryRow(ctx, countQuery, args...).Scan(&totalItems)
+		if err != nil {
+			http.Error(w, "Error counting total items", http.StatusInternalServerError)
+			return
+		}
+
+		response.Pagination.CurrentPage = page
+		response.Pagination.TotalItems = totalItems
+		response.Pagination.TotalPages = (totalItems + limit - 1) / limit
 	}
 
 	// Return response
@@ -220,18 +282,25 @@ func GetContentByIdHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	// Flag the content if the calling user has upvoted it (user ID 0 never matches)
+	var currentUserID int
+	if currentUser, ok := r.Context().Value(models.UserContextKey).(models.User); ok {
+		currentUserID = currentUser.ID
+	}
+
 	// Query the content
 	var item models.ContentItem
 	var createdAt time.Time
 
 	err = database.DBPool.QueryRow(ctx,
 		`SELECT c.id, c.title, c.description, c.image_count, c.video_count, 
-		c.thumbnail_url, c.created_at, (SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) AS upvotes,
-		u.id, u.username
+		`+contentThumbnailSQL+`, c.created_at, c.upvote_count AS upvotes, c.comment_count,
+		EXISTS(SELECT 1 FROM upvotes WHERE content_id = c.id AND user_id = $2) AS has_upvoted,
+		c.moderation_status, u.id, u.username
 		FROM content c 
 		JOIN users u ON c.user_id = u.id
 		WHERE c.id = $1`,
-		contentID,
+		contentID, currentUserID,
 	).Scan(
 		&item.ID,
 		&item.Title,
@@ -241,6 +310,9 @@ func GetContentByIdHandler(w http.ResponseWriter, r *http.Request) {
 		&item.Thumbnail,
 		&createdAt,
 		&item.Upvotes,
+		&item.CommentCount,
+		&item.HasUpvoted,
+		&item.ModerationStatus,
 		&item.User.ID,
 		&item.User.Username,
 	)
@@ -254,6 +326,12 @@ func GetContentByIdHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Content awaiting or removed by moderation is only visible to its author
+	if item.ModerationStatus != "approved" && item.User.ID != currentUserID {
+		http.Error(w, "Content not found", http.StatusNotFound)
+		return
+	}
+
 	item.CreatedAt = createdAt.Format(time.RFC3339)
 
 	// Get tags for the content
@@ -307,6 +385,7 @@ func GetContentByIdHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Ensure images are properly assigned
+	attachImageVariants(ctx, images)
 	item.Images = images
 
 	// Return response
@@ -348,6 +427,15 @@ func CreateContentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback(ctx)
 
+	// Only files the user uploaded can be attached
+	if owned, err := uploadsOwnedTx(ctx, tx, user.ID, 0, contentFileURLs(req)); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	} else if !owned {
+		http.Error(w, "Images must be files you uploaded", http.StatusBadRequest)
+		return
+	}
+
 	// Insert content
 	var contentID int
 	err = tx.QueryRow(ctx,
@@ -363,51 +451,15 @@ func CreateContentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Handle tags if provided
-	if len(req.Tags) > 0 {
-		for _, tagName := range req.Tags {
-			var tagID int
-
-			// Try to find existing tag or create a new one
-			err = tx.QueryRow(ctx,
-				`INSERT INTO tags (name) VALUES ($1) 
-				ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name 
-				RETURNING id`,
-				tagName,
-			).Scan(&tagID)
-
-			if err != nil {
-				http.Error(w, "Error processing tags", http.StatusInternalServerError)
-				return
-			}
-
-			// Create link between content and tag
-			_, err = tx.Exec(ctx,
-				`INSERT INTO content_tags (content_id, tag_id) VALUES ($1, $2)
-				ON CONFLICT DO NOTHING`,
-				contentID, tagID,
-			)
-
-			if err != nil {
-				http.Error(w, "Error linking content to tags", http.StatusInternalServerError)
-				return
-			}
-		}
+	if err := insertContentTags(ctx, tx, contentID, req.Tags); err != nil {
+		http.Error(w, "Error processing tags", http.StatusInternalServerError)
+		return
 	}
 
 	// Handle images if provided
-	if len(req.Images) > 0 {
-		for i, imageURL := range req.Images {
-			_, err = tx.Exec(ctx,
-				`INSERT INTO content_images (content_id, image_url, image_order) 
-				VALUES ($1, $2, $3)`,
-				contentID, imageURL, i,
-			)
-
-			if err != nil {
-				http.Error(w, "Error saving images", http.StatusInternalServerError)
-				return
-			}
-		}
+	if err := insertContentImages(ctx, tx, contentID, req.Images); err != nil {
+		http.Error(w, "Error saving images", http.StatusInternalServerError)
+		return
 	}
 
 	// Commit transaction
@@ -428,6 +480,346 @@ func CreateContentHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// UpdateContentHandler edits content owned by the caller. Only the fields in
+// the request change; tags and images are replaced when they are sent.
+func UpdateContentHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context (set by AuthMiddleware)
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	// Get content ID from URL
+	contentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var req models.UpdateContentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate input
+	if req.Title != nil && *req.Title == "" {
+		http.Error(w, "Title is required", http.StatusBadRequest)
+		return
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Begin transaction
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Check if content belongs to user (row is locked until commit)
+	if !lockOwnedContent(ctx, w, tx, contentID, user.ID) {
+		return
+	}
+
+	// Only files the user uploaded, or that the content already had, can be attached
+	var fileURLs []string
+	if req.Images != nil {
+		fileURLs = append(fileURLs, *req.Images...)
+	}
+	if req.ThumbnailURL != nil && *req.ThumbnailURL != "" {
+		fileURLs = append(fileURLs, *req.ThumbnailURL)
+	}
+	if owned, err := uploadsOwnedTx(ctx, tx, user.ID, contentID, fileURLs); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	} else if !owned {
+		http.Error(w, "Images must be files you uploaded", http.StatusBadRequest)
+		return
+	}
+
+	// Update content
+	var title string
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx,
+		`UPDATE content SET title = COALESCE($1, title), description = COALESCE($2, description),
+		image_count = COALESCE($3, image_count), video_count = COALESCE($4, video_count),
+		thumbnail_url = COALESCE($5, thumbnail_url), updated_at = NOW()
+		WHERE id = $6
+		RETURNING title, updated_at`,
+		req.Title, req.Description, req.ImageCount, req.VideoCount, req.ThumbnailURL, contentID,
+	).Scan(&title, &updatedAt)
+	if err != nil {
+		http.Error(w, "Error updating content", http.StatusInternalServerError)
+		return
+	}
+
+	// Replace tags
+	if req.Tags != nil {
+		if _, err := tx.Exec(ctx, `DELETE FROM content_tags WHERE content_id = $1`, contentID); err != nil {
+			http.Error(w, "Error processing tags", http.StatusInternalServerError)
+			return
+		}
+		if err := insertContentTags(ctx, tx, contentID, *req.Tags); err != nil {
+			http.Error(w, "Error processing tags", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Replace images
+	if req.Images != nil {
+		if _, err := tx.Exec(ctx, `DELETE FROM content_images WHERE content_id = $1`, contentID); err != nil {
+			http.Error(w, "Error saving images", http.StatusInternalServerError)
+			return
+		}
+		if err := insertContentImages(ctx, tx, contentID, *req.Images); err != nil {
+			http.Error(w, "Error saving images", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error finalizing content update", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.UpdateContentResponse{
+		ID:        contentID,
+		Title:     title,
+		UpdatedAt: updatedAt.Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteContentHandler removes content owned by the caller along with everything that references it
+func DeleteContentHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context (set by AuthMiddleware)
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	// Get content ID from URL
+	contentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		return
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Begin transaction
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Check if content belongs to user (row is locked until commit)
+	if !lockOwnedContent(ctx, w, tx, contentID, user.ID) {
+		return
+	}
+
+	// Delete content and everything that references it
+	fileURLs, err := deleteContentTx(ctx, tx, contentID)
+	if err != nil {
+		log.Printf("Error deleting content %d: %v", contentID, err)
+		http.Error(w, "Error deleting content", http.StatusInternalServerError)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error finalizing content deletion", http.StatusInternalServerError)
+		return
+	}
+	removeUploadedFiles(ctx, fileURLs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Content deleted successfully"})
+}
+
+// unreferencedUploadSQL matches uploads (aliased u) among the URLs in $1 that
+// no content, trading item or message uses any more
+const unreferencedUploadSQL = `u.url = ANY($1)
+	AND NOT EXISTS (SELECT 1 FROM content_images WHERE image_url = u.url)
+	AND NOT EXISTS (SELECT 1 FROM content WHERE thumbnail_url = u.url)
+	AND NOT EXISTS (SELECT 1 FROM trading_content WHERE file_url = u.url)
+	AND NOT EXISTS (SELECT 1 FROM messages WHERE attachment_url = u.url)`
+
+// deleteContentTx deletes a content row and the rows that reference it within
+// tx, closes open reports against it and its comments, and forgets the uploads
+// nothing else uses. It returns the URLs of those files and their resized
+// copies; pass them to removeUploadedFiles once the transaction has committed.
+func deleteContentTx(ctx context.Context, tx pgx.Tx, contentID int) ([]string, error) {
+	// Files attached to the content
+	rows, err := tx.Query(ctx, `
+		SELECT image_url FROM content_images WHERE content_id = $1
+		UNION SELECT thumbnail_url FROM content WHERE id = $1 AND thumbnail_url <> ''
+	`, contentID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %v", err)
+	}
+	fileURLs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %v", err)
+	}
+
+	// Touch collections that lose this content so they sort as recently changed
+	_, err = tx.Exec(ctx, `
+		UPDATE collections SET updated_at = NOW()
+		WHERE id IN (SELECT collection_id FROM collection_content WHERE content_id = $1)
+	`, contentID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating collections: %v", err)
+	}
+
+	// Close reports, remove rows that reference the content, then the content itself
+	statements := []string{
+		`UPDATE reports SET status = 'dismissed', resolved_at = NOW(), resolution_note = 'Content was deleted'
+		 WHERE status = 'open' AND ((target_type = 'content' AND target_id = $1)
+		    OR (target_type = 'comment' AND target_id IN (SELECT id FROM comments WHERE content_id = $1)))`,
+		`DELETE FROM upvotes WHERE content_id = $1`,
+		`DELETE FROM comments WHERE content_id = $1`,
+		`DELETE FROM collection_content WHERE content_id = $1`,
+		`DELETE FROM content_tags WHERE content_id = $1`,
+		`DELETE FROM content_images WHERE content_id = $1`,
+		`DELETE FROM content WHERE id = $1`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(ctx, stmt, contentID); err != nil {
+			return nil, fmt.Errorf("error running %q: %v", stmt, err)
+		}
+	}
+
+	// Uploads only this content used go with it, resized copies included
+	rows, err = tx.Query(ctx, `
+		SELECT v.url FROM image_variants v
+		JOIN uploads u ON u.id = v.upload_id
+		WHERE `+unreferencedUploadSQL, fileURLs)
+	if err != nil {
+		return nil, fmt.Errorf("error listing image variants: %v", err)
+	}
+	variantURLs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error listing image variants: %v", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM uploads u WHERE `+unreferencedUploadSQL, fileURLs); err != nil {
+		return nil, fmt.Errorf("error deleting uploads: %v", err)
+	}
+	return append(fileURLs, variantURLs...), nil
+}
+
+// lockOwnedContent locks a content row for the transaction and checks that userID owns it.
+// It writes the error response and returns false when the caller should stop.
+func lockOwnedContent(ctx context.Context, w http.ResponseWriter, tx pgx.Tx, contentID, userID int) bool {
+	var ownerID int
+	err := tx.QueryRow(ctx,
+		`SELECT user_id FROM content WHERE id = $1 FOR UPDATE`,
+		contentID,
+	).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Content not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	if ownerID != userID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// insertContentTags creates any missing tags and links them to the content
+func insertContentTags(ctx context.Context, tx pgx.Tx, contentID int, tagNames []string) error {
+	for _, tagName := range tagNames {
+		var tagID int
+
+		// Try to find existing tag or create a new one
+		err := tx.QueryRow(ctx,
+			`INSERT INTO tags (name) VALUES ($1) 
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name 
+			RETURNING id`,
+			tagName,
+		).Scan(&tagID)
+		if err != nil {
+			return fmt.Errorf("error creating tag %q: %v", tagName, err)
+		}
+
+		// Create link between content and tag
+		_, err = tx.Exec(ctx,
+			`INSERT INTO content_tags (content_id, tag_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`,
+			contentID, tagID,
+		)
+		if err != nil {
+			return fmt.Errorf("error linking tag %q: %v", tagName, err)
+		}
+	}
+	return nil
+}
+
+// insertContentImages stores the image URLs for the content in the given order
+func insertContentImages(ctx context.Context, tx pgx.Tx, contentID int, imageURLs []string) error {
+	for i, imageURL := range imageURLs {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO content_images (content_id, image_url, image_order) 
+			VALUES ($1, $2, $3)`,
+			contentID, imageURL, i,
+		)
+		if err != nil {
+			return fmt.Errorf("error saving image %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// contentFileURLs lists the image and thumbnail URLs a content request attaches
+func contentFileURLs(req models.CreateContentRequest) []string {
+	urls := append([]string{}, req.Images...)
+	if req.ThumbnailURL != "" {
+		urls = append(urls, req.ThumbnailURL)
+	}
+	return urls
+}
+
+// uploadsOwnedTx reports whether every URL is a file userID uploaded or is
+// already attached to contentID (0 for new content), so content created before
+// uploads were recorded can still be edited
+func uploadsOwnedTx(ctx context.Context, tx pgx.Tx, userID, contentID int, urls []string) (bool, error) {
+	if len(urls) == 0 {
+		return true, nil
+	}
+
+	var owned bool
+	err := tx.QueryRow(ctx, `
+		SELECT NOT EXISTS (
+			SELECT 1 FROM unnest($1::text[]) AS requested(url)
+			WHERE NOT EXISTS (SELECT 1 FROM uploads u WHERE u.url = requested.url AND u.user_id = $2)
+			  AND NOT EXISTS (SELECT 1 FROM content_images ci WHERE ci.content_id = $3 AND ci.image_url = requested.url)
+			  AND NOT EXISTS (SELECT 1 FROM content c WHERE c.id = $3 AND c.thumbnail_url = requested.url)
+		)
+	`, urls, userID, contentID).Scan(&owned)
+	return owned, err
+}
+
 // GetTagsHandler retrieves all available tags
 func GetTagsHandler(w http.ResponseWriter, r *http.Request) {
 	// Create context with timeout
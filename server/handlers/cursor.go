@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultPageSize is the number of items per page when the client does not ask for one
+	defaultPageSize = 20
+	// maxPageSize caps the page size a client can request
+	maxPageSize = 50
+)
+
+// feedCursor marks the last item of a page in a sorted content listing.
+// Clients receive it base64 encoded and pass it back unchanged.
+type feedCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+	AsOf  int64  `json:"t,omitempty"` // hot sort reference time, unix microseconds
+}
+
+// feedSort describes how a listing is ordered and how to resume after a cursor
+type feedSort struct {
+	// valueExpr is the SQL expression the listing is sorted by, before c.id
+	valueExpr string
+	// valueType is the Postgres type the cursor value is cast back to
+	valueType string
+	// orderClause orders rows by valueExpr and then c.id, both descending
+	orderClause string
+	// cursorable is false for orders that cannot be resumed, such as shuffle
+	cursorable bool
+}
+
+// parsePageSize reads the "limit" query parameter, clamped to maxPageSize
+func parsePageSize(raw string) int {
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+// contentFeedSort returns the ordering for a sort name. asOf is the placeholder
+// holding the reference time of the hot score and is only used by "hot".
+func contentFeedSort(sort, asOf string) feedSort {
+	switch sort {
+	case "top":
+		return feedSort{
+			valueExpr:   "c.upvote_count",
+			valueType:   "integer",
+			orderClause: "ORDER BY c.upvote_count DESC, c.id DESC ",
+			cursorable:  true,
+		}
+	case "hot":
+		// Hot algorithm: Upvotes combined with recency
+		hotExpr := fmt.Sprintf("c.upvote_count * (1.0 / (EXTRACT(EPOCH FROM (%s::timestamptz - c.created_at))/86400 + 2)^1.5)", asOf)
+		return feedSort{
+			valueExpr:   hotExpr,
+			valueType:   "numeric",
+			orderClause: "ORDER BY " + hotExpr + " DESC, c.id DESC ",
+			cursorable:  true,
+		}
+	case "shuffle":
+		return feedSort{
+			valueExpr:   "''",
+			valueType:   "text",
+			orderClause: "ORDER BY RANDOM() ",
+		}
+	default:
+		return feedSort{
+			valueExpr:   "c.created_at",
+			valueType:   "timestamptz",
+			orderClause: "ORDER BY c.created_at DESC, c.id DESC ",
+			cursorable:  true,
+		}
+	}
+}
+
+// encodeFeedCursor serializes a cursor into an opaque URL-safe string
+func encodeFeedCursor(c feedCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeFeedCursor parses a cursor produced by encodeFeedCursor
+func decodeFeedCursor(s string) (feedCursor, error) {
+	var c feedCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("malformed cursor")
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == 0 {
+		return c, errors.New("malformed cursor")
+	}
+	if c.Sort == "hot" && c.AsOf == 0 {
+		return c, errors.New("malformed cursor")
+	}
+	return c, nil
+}
+
+// cursorAsOf returns the hot sort reference time stored in a cursor
+func cursorAsOf(c feedCursor) time.Time {
+	return time.UnixMicro(c.AsOf)
+}
@@ -47,8 +47,10 @@ func GetUserDashboardHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user's content
 	contentRows, err := database.DBPool.Query(ctx, `
 		SELECT c.id, c.title, c.description, c.image_count, c.video_count, 
-		       c.thumbnail_url, c.created_at,
-		       (SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) as upvotes
+		       `+contentThumbnailSQL+`, c.created_at,
+		       c.upvote_count as upvotes, c.comment_count,
+		       EXISTS(SELECT 1 FROM upvotes WHERE content_id = c.id AND user_id = $1) AS has_upvoted,
+		       c.moderation_status
 		FROM content c
 		WHERE c.user_id = $1
 		ORDER BY c.created_at DESC
@@ -75,6 +77,9 @@ func GetUserDashboardHandler(w http.ResponseWriter, r *http.Request) {
 			&item.Thumbnail,
 			&createdAt,
 			&item.Upvotes,
+			&item.CommentCount,
+			&item.HasUpvoted,
+			&item.ModerationStatus,
 		)
 		if err != nil {
 			http.Error(w, "Error parsing content", http.StatusInternalServerError)
@@ -105,6 +110,7 @@ func GetUserDashboardHandler(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 			imageRows.Close()
+			attachImageVariants(ctx, images)
 			item.Images = images
 		}
 
@@ -165,7 +171,7 @@ func GetUserDashboardHandler(w http.ResponseWriter, r *http.Request) {
 		SELECT 
 			(SELECT COUNT(*) FROM content WHERE user_id = $1) as content_count,
 			(SELECT COUNT(*) FROM collections WHERE user_id = $1) as collection_count,
-			(SELECT COUNT(*) FROM upvotes u JOIN content c ON u.content_id = c.id WHERE c.user_id = $1) as total_upvotes,
+			(SELECT COALESCE(SUM(upvote_count), 0) FROM content WHERE user_id = $1) as total_upvotes,
 			(SELECT COUNT(*) FROM follows WHERE following_id = $1) as follower_count
 	`, user.ID).Scan(&stats.ContentCount, &stats.CollectionCount, &stats.TotalUpvotes, &stats.FollowerCount)
 	if err != nil {
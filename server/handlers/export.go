@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"project/server/database"
+	"project/server/models"
+	"project/server/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// exportSection is one JSON file of a data export
+type exportSection struct {
+	name  string
+	query string
+	// single sections hold one object rather than a list
+	single bool
+}
+
+// exportSections lists everything a data export contains. Each query takes
+// the user ID as $1.
+var exportSections = []exportSection{
+	{name: "profile.json", single: true, query: `
+		SELECT id, username, email, role, created_at, updated_at, verified_at, last_active_at,
+		       totp_enabled_at IS NOT NULL AS two_factor_enabled, deletion_scheduled_for
+		FROM users WHERE id = $1`},
+	{name: "content.json", query: `
+		SELECT c.id, c.title, c.description, c.thumbnail_url, c.image_count, c.video_count,
+		       c.upvote_count, c.comment_count, c.moderation_status, c.created_at, c.updated_at,
+		       ARRAY(SELECT ci.image_url FROM content_images ci WHERE ci.content_id = c.id
+		             ORDER BY ci.image_order, ci.id) AS images,
+		       ARRAY(SELECT t.name FROM content_tags ct JOIN tags t ON t.id = ct.tag_id
+		             WHERE ct.content_id = c.id ORDER BY t.name) AS tags
+		FROM content c WHERE c.user_id = $1 ORDER BY c.id`},
+	{name: "comments.json", query: `
+		SELECT id, content_id, parent_id, body, created_at, updated_at, deleted_at
+		FROM comments WHERE user_id = $1 ORDER BY id`},
+	{name: "upvotes.json", query: `
+		SELECT content_id, created_at FROM upvotes WHERE user_id = $1 ORDER BY created_at`},
+	{name: "follows.json", query: `
+		SELECT 'following' AS direction, u.username, f.created_at
+		FROM follows f JOIN users u ON u.id = f.following_id WHERE f.follower_id = $1
+		UNION ALL
+		SELECT 'follower', u.username, f.created_at
+		FROM follows f JOIN users u ON u.id = f.follower_id WHERE f.following_id = $1
+		ORDER BY created_at`},
+	{name: "collections.json", query: `
+		SELECT c.id, c.name, c.description, c.is_public, c.created_at, c.updated_at,
+		       ARRAY(SELECT cc.content_id FROM collection_content cc WHERE cc.collection_id = c.id
+		             ORDER BY cc.added_at) AS content_ids
+		FROM collections c WHERE c.user_id = $1 ORDER BY c.id`},
+	{name: "messages.json", query: `
+		SELECT m.id, sender.username AS from_username, recipient.username AS to_username,
+		       m.message, m.attachment_url, m.created_at, m.read_at
+		FROM messages m
+		LEFT JOIN users sender ON sender.id = m.from_user_id
+		LEFT JOIN users recipient ON recipient.id = m.to_user_id
+		WHERE m.from_user_id = $1 OR m.to_user_id = $1
+		ORDER BY m.created_at, m.id`},
+	{name: "trading_content.json", query: `
+		SELECT id, title, description, file_url, is_traded, created_at
+		FROM trading_content WHERE user_id = $1 ORDER BY id`},
+	{name: "trade_requests.json", query: `
+		SELECT tr.id, sender.username AS from_username, recipient.username AS to_username,
+		       tr.trading_content_id, tr.offered_content_id, tr.status, tr.created_at
+		FROM trade_requests tr
+		LEFT JOIN users sender ON sender.id = tr.from_user_id
+		LEFT JOIN users recipient ON recipient.id = tr.to_user_id
+		WHERE tr.from_user_id = $1 OR tr.to_user_id = $1
+		ORDER BY tr.id`},
+	{name: "uploads.json", query: `
+		SELECT url, size_bytes, mime_type, checksum, created_at FROM uploads WHERE user_id = $1 ORDER BY id`},
+	{name: "identities.json", query: `
+		SELECT provider, email, created_at FROM user_identities WHERE user_id = $1 ORDER BY id`},
+}
+
+// ExportUserDataHandler streams a zip archive of everything the authenticated
+// user owns: one JSON file per kind of data and their uploaded files under files/
+func ExportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
+	defer cancel()
+
+	// Read everything in one snapshot before writing, so database errors can
+	// still be reported with a proper status
+	tx, err := database.DBPool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	sections := make(map[string]interface{}, len(exportSections))
+	for _, section := range exportSections {
+		rows, err := tx.Query(ctx, section.query, user.ID)
+		if err != nil {
+			log.Printf("Error exporting %s for user %d: %v", section.name, user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		records, err := pgx.CollectRows(rows, pgx.RowToMap)
+		if err != nil {
+			log.Printf("Error exporting %s for user %d: %v", section.name, user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if section.single {
+			if len(records) == 0 {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			sections[section.name] = records[0]
+		} else {
+			sections[section.name] = records
+		}
+	}
+
+	rows, err := tx.Query(ctx, userFilesQuery, user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	fileURLs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Release the connection before the slow part
+	tx.Rollback(ctx)
+
+	filename := fmt.Sprintf("arouzy-export-%s-%s.zip", user.Username, time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Archives with many files take longer than the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(10 * time.Minute)); err != nil {
+		log.Printf("Error extending write deadline for export: %v", err)
+	}
+
+	// From here on the response is streaming; failures can only be logged
+	zw := zip.NewWriter(w)
+	for _, section := range exportSections {
+		f, err := zw.Create(section.name)
+		if err != nil {
+			log.Printf("Error writing export for user %d: %v", user.ID, err)
+			return
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sections[section.name]); err != nil {
+			log.Printf("Error writing export for user %d: %v", user.ID, err)
+			return
+		}
+	}
+
+	for _, fileURL := range fileURLs {
+		key, ok := storage.KeyFromURL(fileURL)
+		if !ok {
+			// Files hosted elsewhere are only listed by URL
+			continue
+		}
+		if err := addFileToZip(r.Context(), zw, "files/"+path.Base(key), key); err != nil {
+			log.Printf("Error adding %s to export for user %d: %v", key, user.ID, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Printf("Error finishing export for user %d: %v", user.ID, err)
+	}
+}
+
+// addFileToZip copies a stored file into the archive. Missing files are skipped.
+func addFileToZip(ctx context.Context, zw *zip.Writer, name, key string) error {
+	src, info, err := storage.Default.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+
+	// Images and videos are already compressed
+	header := &zip.FileHeader{Name: name, Method: zip.Store, Modified: info.ModTime}
+
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
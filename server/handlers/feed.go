@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"project/server/models"
+)
+
+// GetFollowingFeedHandler lists content from accounts the authenticated user follows.
+// It accepts the same sort, filter and pagination parameters as GetContentHandler.
+func GetFollowingFeedHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context (set by AuthMiddleware)
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	// The semi-join lets Postgres walk the follows primary key and the
+	// per-author content index instead of materializing the followed list
+	serveContentList(w, r,
+		"WHERE c.user_id IN (SELECT following_id FROM follows WHERE follower_id = $1) AND c.moderation_status = 'approved' ",
+		[]interface{}{user.ID},
+	)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errUnsupportedFileType = errors.New("Invalid file type. Only images and videos are allowed.")
+	errFileTypeMismatch    = errors.New("File contents do not match its type")
+)
+
+// allowedUploadTypes maps each accepted extension to the content types its
+// bytes may turn out to be. MP4 and QuickTime share a container, so either
+// extension is accepted for both.
+var allowedUploadTypes = map[string][]string{
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".png":  {"image/png"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+	".mp4":  {"video/mp4", "video/quicktime"},
+	".mov":  {"video/quicktime", "video/mp4"},
+	".avi":  {"video/x-msvideo"},
+	".mkv":  {"video/x-matroska", "video/webm"},
+	".webm": {"video/webm"},
+}
+
+// mp4Brands are ftyp major brands of MP4 video files
+var mp4Brands = map[string]bool{
+	"isom": true, "iso2": true, "iso4": true, "iso5": true, "iso6": true,
+	"mp41": true, "mp42": true, "avc1": true, "dash": true, "mmp4": true,
+	"M4V ": true, "M4VP": true, "MSNV": true, "f4v ": true,
+}
+
+// sniffLength is how much of a file is read to recognise its format
+const sniffLength = 4096
+
+// detectUploadType checks that file really is the image or video its name
+// claims and returns the detected content type. It reads the file's
+// signature and, for images, decodes the header; file is rewound afterwards.
+func detectUploadType(file io.ReadSeeker, filename string) (string, error) {
+	allowed, ok := allowedUploadTypes[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		return "", errUnsupportedFileType
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", errFileTypeMismatch
+	}
+	head = head[:n]
+
+	contentType := sniffContentType(head)
+	matches := false
+	for _, t := range allowed {
+		matches = matches || t == contentType
+	}
+	if !matches {
+		return "", errFileTypeMismatch
+	}
+
+	// Image signatures are easy to fake; the header must decode too
+	switch contentType {
+	case "image/webp":
+		if _, _, ok := webpSize(head); !ok {
+			return "", errFileTypeMismatch
+		}
+	case "image/jpeg", "image/png", "image/gif":
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		config, _, err := image.DecodeConfig(file)
+		if err != nil || config.Width <= 0 || config.Height <= 0 {
+			return "", errFileTypeMismatch
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return contentType, nil
+}
+
+// sniffContentType recognises the supported formats from a file's first
+// bytes, returning "" for anything else
+func sniffContentType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "image/gif"
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return "image/webp"
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "AVI ":
+		return "video/x-msvideo"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		// ISO base media file; the major brand tells MP4 from QuickTime
+		// and from still-image formats like HEIC and AVIF
+		brand := string(head[8:12])
+		if brand == "qt  " {
+			return "video/quicktime"
+		}
+		if mp4Brands[brand] {
+			return "video/mp4"
+		}
+	case len(head) >= 8 && (string(head[4:8]) == "moov" || string(head[4:8]) == "mdat" || string(head[4:8]) == "wide"):
+		// Old QuickTime files start without an ftyp box
+		return "video/quicktime"
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		switch ebmlDocType(head) {
+		case "webm":
+			return "video/webm"
+		case "matroska":
+			return "video/x-matroska"
+		}
+	}
+	return ""
+}
+
+// ebmlDocType returns the DocType of an EBML (Matroska/WebM) header
+func ebmlDocType(head []byte) string {
+	i := bytes.Index(head, []byte{0x42, 0x82})
+	if i < 0 || i+2 >= len(head) {
+		return ""
+	}
+	// The size is a variable-length integer; its first byte's leading
+	// zeros give the number of following bytes
+	sizeByte := head[i+2]
+	length := 1
+	for mask := byte(0x80); mask != 0 && sizeByte&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || i+2+length > len(head) {
+		return ""
+	}
+	size := uint64(sizeByte & (0xFF >> length))
+	for _, b := range head[i+3 : i+2+length] {
+		size = size<<8 | uint64(b)
+	}
+	start := i + 2 + length
+	if size == 0 || size > 32 || start+int(size) > len(head) {
+		return ""
+	}
+	return strings.TrimRight(string(head[start:start+int(size)]), "\x00")
+}
+
+// webpSize reads the canvas size from a WebP file's first chunk
+func webpSize(head []byte) (int, int, bool) {
+	if len(head) < 30 {
+		return 0, 0, false
+	}
+	data := head[20:]
+	var width, height int
+	switch string(head[12:16]) {
+	case "VP8 ":
+		// Lossy: a key frame start code followed by 14-bit dimensions
+		if !bytes.Equal(data[3:6], []byte{0x9D, 0x01, 0x2A}) {
+			return 0, 0, false
+		}
+		width = int(binary.LittleEndian.Uint16(data[6:8]) & 0x3FFF)
+		height = int(binary.LittleEndian.Uint16(data[8:10]) & 0x3FFF)
+	case "VP8L":
+		// Lossless: a signature byte followed by 14-bit width-1 and height-1
+		if data[0] != 0x2F {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(data[1:5])
+		width = int(bits&0x3FFF) + 1
+		height = int(bits>>14&0x3FFF) + 1
+	case "VP8X":
+		// Extended: 24-bit canvas width-1 and height-1
+		width = int(uint32(data[4])|uint32(data[5])<<8|uint32(data[6])<<16) + 1
+		height = int(uint32(data[7])|uint32(data[8])<<8|uint32(data[9])<<16) + 1
+	default:
+		return 0, 0, false
+	}
+	return width, height, width > 0 && height > 0
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// ebmlHeader builds an EBML header with the given DocType element bytes
+func ebmlHeader(docType ...byte) []byte {
+	head := []byte{0x1A, 0x45, 0xDF, 0xA3, 0x9F, 0x42, 0x86, 0x81, 0x01}
+	return append(head, docType...)
+}
+
+// webpHead builds the start of a WebP file whose first chunk is fourCC
+func webpHead(fourCC string, data ...byte) []byte {
+	head := []byte("RIFF\x00\x00\x00\x00WEBP" + fourCC)
+	head = binary.LittleEndian.AppendUint32(head, uint32(len(data)))
+	head = append(head, data...)
+	for len(head) < 30 {
+		head = append(head, 0)
+	}
+	return head
+}
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0}, "image/jpeg"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), "image/png"},
+		{"gif87a", []byte("GIF87a"), "image/gif"},
+		{"gif89a", []byte("GIF89a"), "image/gif"},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "image/webp"},
+		{"avi", []byte("RIFF\x00\x00\x00\x00AVI LIST"), "video/x-msvideo"},
+		{"mp4", []byte("\x00\x00\x00\x18ftypisom"), "video/mp4"},
+		{"m4v", []byte("\x00\x00\x00\x18ftypM4V "), "video/mp4"},
+		{"quicktime", []byte("\x00\x00\x00\x14ftypqt  "), "video/quicktime"},
+		{"old quicktime", []byte("\x00\x00\x00\x08wide"), "video/quicktime"},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic"), ""},
+		{"avif", []byte("\x00\x00\x00\x18ftypavif"), ""},
+		{"webm", ebmlHeader(0x42, 0x82, 0x84, 'w', 'e', 'b', 'm'), "video/webm"},
+		{"matroska", ebmlHeader(0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a'), "video/x-matroska"},
+		{"ebml without doctype", ebmlHeader(), ""},
+		{"short riff", []byte("RIFF\x00\x00"), ""},
+		{"text", []byte("<html><body>"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffContentType(tt.head); got != tt.want {
+				t.Errorf("sniffContentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEBMLDocType(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"one byte size", ebmlHeader(0x42, 0x82, 0x84, 'w', 'e', 'b', 'm'), "webm"},
+		{"two byte size", ebmlHeader(0x42, 0x82, 0x40, 0x04, 'w', 'e', 'b', 'm'), "webm"},
+		{"null padded", ebmlHeader(0x42, 0x82, 0x86, 'w', 'e', 'b', 'm', 0, 0), "webm"},
+		{"missing", ebmlHeader(), ""},
+		{"no size", ebmlHeader(0x42, 0x82), ""},
+		{"zero size", ebmlHeader(0x42, 0x82, 0x80), ""},
+		{"size past end", ebmlHeader(0x42, 0x82, 0x88, 'w', 'e', 'b', 'm'), ""},
+		{"size too large", append(ebmlHeader(0x42, 0x82, 0xA1), bytes.Repeat([]byte{'a'}, 33)...), ""},
+		{"invalid size byte", ebmlHeader(0x42, 0x82, 0x00, 'w'), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ebmlDocType(tt.head); got != tt.want {
+				t.Errorf("ebmlDocType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebPSize(t *testing.T) {
+	// 640x480 packed as 14-bit width-1 and height-1 after the signature byte
+	lossless := binary.LittleEndian.AppendUint32([]byte{0x2F}, 639|479<<14)
+
+	tests := []struct {
+		name          string
+		head          []byte
+		width, height int
+		ok            bool
+	}{
+		{"lossy", webpHead("VP8 ", 0x10, 0x02, 0x00, 0x9D, 0x01, 0x2A, 0x80, 0x02, 0xE0, 0x01), 640, 480, true},
+		{"lossy scale bits ignored", webpHead("VP8 ", 0x10, 0x02, 0x00, 0x9D, 0x01, 0x2A, 0x80, 0x42, 0xE0, 0x81), 640, 480, true},
+		{"lossy bad start code", webpHead("VP8 ", 0x10, 0x02, 0x00, 0x9D, 0x01, 0x2B, 0x80, 0x02, 0xE0, 0x01), 0, 0, false},
+		{"lossy zero width", webpHead("VP8 ", 0x10, 0x02, 0x00, 0x9D, 0x01, 0x2A, 0x00, 0x00, 0xE0, 0x01), 0, 0, false},
+		{"lossless", webpHead("VP8L", lossless...), 640, 480, true},
+		{"lossless bad signature", webpHead("VP8L", 0x2E, 0x7F, 0x02, 0x77, 0x00), 0, 0, false},
+		{"extended", webpHead("VP8X", 0x10, 0, 0, 0, 0x7F, 0x07, 0x00, 0x37, 0x04, 0x00), 1920, 1080, true},
+		{"unknown chunk", webpHead("ALPH", 0, 0, 0, 0), 0, 0, false},
+		{"too short", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, ok := webpSize(tt.head)
+			if ok != tt.ok || ok && (width != tt.width || height != tt.height) {
+				t.Errorf("webpSize() = %d, %d, %v, want %d, %d, %v", width, height, ok, tt.width, tt.height, tt.ok)
+			}
+		})
+	}
+}
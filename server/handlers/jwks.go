@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"project/server/utils"
+)
+
+// JWKSHandler publishes the public keys that access tokens can be verified
+// with, so other services can check tokens without sharing a secret
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := utils.PublicJWKs()
+	if err != nil {
+		log.Printf("Error loading JWT keys: %v", err)
+		http.Error(w, "Error loading keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
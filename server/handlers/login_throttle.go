@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"project/server/database"
+)
+
+// throttlePolicy decides when a throttle key gets locked and for how long
+type throttlePolicy struct {
+	// threshold is the number of failures within throttleWindow before locking
+	threshold int
+	// baseDelay is the lock applied at the threshold; each further failure doubles it
+	baseDelay time.Duration
+	// maxDelay caps the lock
+	maxDelay time.Duration
+}
+
+var (
+	// accountThrottle protects a single account from password guessing
+	accountThrottle = throttlePolicy{threshold: 5, baseDelay: 30 * time.Second, maxDelay: time.Hour}
+	// ipThrottle slows down one address trying many accounts; it is looser
+	// because several users can share an address
+	ipThrottle = throttlePolicy{threshold: 20, baseDelay: time.Minute, maxDelay: time.Hour}
+	// resetAccountThrottle limits password reset emails sent to one address
+	resetAccountThrottle = throttlePolicy{threshold: 3, baseDelay: 15 * time.Minute, maxDelay: 24 * time.Hour}
+	// resetIPThrottle limits password reset requests from one address
+	resetIPThrottle = throttlePolicy{threshold: 10, baseDelay: 15 * time.Minute, maxDelay: 24 * time.Hour}
+)
+
+const (
+	// throttleWindow is how long failures are remembered; a key with no
+	// failures for this long starts counting from zero again
+	throttleWindow = 24 * time.Hour
+	// loginEventRetention is how long login events are kept for the admin panel
+	loginEventRetention = 30 * 24 * time.Hour
+	// throttlePruneInterval is how often stale throttle rows and events are deleted
+	throttlePruneInterval = 10 * time.Minute
+)
+
+var lastThrottlePrune = struct {
+	sync.Mutex
+	at time.Time
+}{}
+
+// lockDuration returns how long a key is locked after its nth failure, or 0
+func (p throttlePolicy) lockDuration(failures int) time.Duration {
+	if failures < p.threshold {
+		return 0
+	}
+	exponent := failures - p.threshold
+	if exponent > 20 {
+		return p.maxDelay
+	}
+	delay := p.baseDelay * time.Duration(1<<exponent)
+	if delay > p.maxDelay {
+		return p.maxDelay
+	}
+	return delay
+}
+
+// accountThrottleKey returns the throttle key of the account an email refers to.
+// Unknown emails are throttled too, so lockouts do not reveal which accounts exist.
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// ipThrottleKey returns the throttle key of a client address
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginRetryAfter reports how long until a login for email from ip may be
+// attempted, or 0 if neither is locked
+func loginRetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	return throttleRetryAfter(ctx, accountThrottleKey(email), ipThrottleKey(ip))
+}
+
+// throttleRetryAfter reports how long until the last of keys is unlocked, or
+// 0 if none is locked
+func throttleRetryAfter(ctx context.Context, keys ...string) (time.Duration, error) {
+	var lockedUntil *time.Time
+	err := database.DBPool.QueryRow(ctx, `
+		SELECT MAX(locked_until) FROM login_throttles
+		WHERE key = ANY($1) AND locked_until > NOW()
+	`, keys).Scan(&lockedUntil)
+	if err != nil || lockedUntil == nil {
+		return 0, err
+	}
+	return time.Until(*lockedUntil), nil
+}
+
+// countThrottleFailure counts one failure against key and locks it once
+// policy's threshold is passed, reporting whether it was locked
+func countThrottleFailure(ctx context.Context, key string, policy throttlePolicy) bool {
+	var failures int
+	err := database.DBPool.QueryRow(ctx, `
+		INSERT INTO login_throttles (key, failures, last_failure_at) VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < NOW() - $2::interval
+				THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = NOW()
+		RETURNING failures
+	`, key, intervalString(throttleWindow)).Scan(&failures)
+	if err != nil {
+		log.Printf("Error recording failure for %s: %v", key, err)
+		return false
+	}
+
+	delay := policy.lockDuration(failures)
+	if delay == 0 {
+		return false
+	}
+	_, err = database.DBPool.Exec(ctx, `
+		UPDATE login_throttles SET locked_until = NOW() + $2::interval WHERE key = $1
+	`, key, intervalString(delay))
+	if err != nil {
+		log.Printf("Error locking %s: %v", key, err)
+		return false
+	}
+	log.Printf("Locked %s for %s after %d failures", key, delay, failures)
+	return true
+}
+
+// recordLoginFailure counts a failed login against the account and the client
+// address, locks whichever passed its threshold and records the event.
+// userID is nil when the email does not belong to an account.
+func recordLoginFailure(ctx context.Context, email, ip string, userID *int) {
+	locked := false
+	for key, policy := range map[string]throttlePolicy{
+		accountThrottleKey(email): accountThrottle,
+		ipThrottleKey(ip):         ipThrottle,
+	} {
+		if countThrottleFailure(ctx, key, policy) {
+			locked = true
+		}
+	}
+
+	events := []string{"failure"}
+	if locked {
+		events = append(events, "lockout")
+	}
+	for _, event := range events {
+		_, err := database.DBPool.Exec(ctx, `
+			INSERT INTO login_events (user_id, email, ip_address, event_type) VALUES ($1, $2, $3, $4)
+		`, userID, strings.ToLower(strings.TrimSpace(email)), ip, event)
+		if err != nil {
+			log.Printf("Error recording login event: %v", err)
+		}
+	}
+
+	pruneLoginThrottles(ctx)
+}
+
+// clearAccountThrottle forgets the failures of an account after a successful
+// login. The address counter is kept, so an attacker cannot reset it by
+// signing in to an account of their own between guesses.
+func clearAccountThrottle(ctx context.Context, email string) {
+	_, err := database.DBPool.Exec(ctx, `DELETE FROM login_throttles WHERE key = $1`, accountThrottleKey(email))
+	if err != nil {
+		log.Printf("Error clearing login throttle: %v", err)
+	}
+}
+
+// pruneLoginThrottles deletes expired throttle rows and old events, at most
+// once per throttlePruneInterval per instance
+func pruneLoginThrottles(ctx context.Context) {
+	lastThrottlePrune.Lock()
+	if time.Since(lastThrottlePrune.at) < throttlePruneInterval {
+		lastThrottlePrune.Unlock()
+		return
+	}
+	lastThrottlePrune.at = time.Now()
+	lastThrottlePrune.Unlock()
+
+	_, err := database.DBPool.Exec(ctx, `
+		DELETE FROM login_throttles
+		WHERE last_failure_at < NOW() - $1::interval AND (locked_until IS NULL OR locked_until < NOW())
+	`, intervalString(throttleWindow))
+	if err != nil {
+		log.Printf("Error pruning login throttles: %v", err)
+	}
+	_, err = database.DBPool.Exec(ctx, `
+		DELETE FROM login_events WHERE created_at < NOW() - $1::interval
+	`, intervalString(loginEventRetention))
+	if err != nil {
+		log.Printf("Error pruning login events: %v", err)
+	}
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, at least 1
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(d.Seconds())))))
+}
+
+// writeTooManyLoginAttempts responds 429 with a Retry-After header
+func writeTooManyLoginAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	setRetryAfter(w, retryAfter)
+	http.Error(w, "Too many failed login attempts, please try again later", http.StatusTooManyRequests)
+}
+
+// intervalString formats a duration as a Postgres interval literal
+func intervalString(d time.Duration) string {
+	return fmt.Sprintf("%d seconds", int(d.Seconds()))
+}
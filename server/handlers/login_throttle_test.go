@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottlePolicyLockDuration(t *testing.T) {
+	policy := throttlePolicy{threshold: 5, baseDelay: 30 * time.Second, maxDelay: time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{11, 32 * time.Minute},
+		{12, time.Hour},
+		{25, time.Hour},
+		// Large counts must not overflow the shift
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := policy.lockDuration(tt.failures); got != tt.want {
+			t.Errorf("lockDuration(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestIntervalString(t *testing.T) {
+	if got := intervalString(90 * time.Second); got != "90 seconds" {
+		t.Errorf("intervalString(90s) = %q, want %q", got, "90 seconds")
+	}
+}
@@ -0,0 +1,671 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/server/database"
+	"project/server/models"
+	"project/server/oidc"
+	"project/server/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// oidcStateTTL is how long a user has to finish logging in at the provider
+	oidcStateTTL = 10 * time.Minute
+	// oidcResultPurpose scopes the signed token the callback hands to the frontend
+	oidcResultPurpose = "oidc-result"
+	// oidcLinkPurpose scopes the signed token confirming a provider account link
+	oidcLinkPurpose = "oidc-link"
+	// oidcLinkStartPurpose scopes the signed token that starts linking an account
+	oidcLinkStartPurpose = "oidc-link-start"
+	// oidcLinkStartTTL is how long the start URL of a link stays valid
+	oidcLinkStartTTL = time.Minute
+	// oidcStateCookie binds a login to the browser that started it
+	oidcStateCookie = "oidc_state"
+	// maxUsernameLength matches users.username
+	maxUsernameLength = 50
+)
+
+// oidcResult is what the callback learned at the provider, passed to the
+// frontend as a signed token and redeemed with CompleteOIDCLoginHandler.
+// Exactly one of UserID (returning user) or Subject (new account) is set.
+// Link tokens carry both: the user linking and the provider account.
+type oidcResult struct {
+	StateID       int    `json:"s"`
+	Provider      string `json:"p"`
+	UserID        int    `json:"u,omitempty"`
+	Subject       string `json:"sub,omitempty"`
+	Email         string `json:"e,omitempty"`
+	EmailVerified bool   `json:"ev,omitempty"`
+	Suggested     string `json:"n,omitempty"`
+}
+
+var usernameUnsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// suggestUsername derives a username suggestion from a provider identity
+func suggestUsername(identity *oidc.Identity) string {
+	for _, candidate := range []string{
+		identity.PreferredUsername,
+		strings.SplitN(identity.Email, "@", 2)[0],
+		identity.Name,
+	} {
+		candidate = usernameUnsafeChars.ReplaceAllString(candidate, "_")
+		candidate = strings.Trim(candidate, "_")
+		if len(candidate) > 30 {
+			candidate = candidate[:30]
+		}
+		if candidate != "" {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// oidcRedirect sends the browser back to the frontend's provider callback page
+func oidcRedirect(w http.ResponseWriter, r *http.Request, params url.Values) {
+	http.Redirect(w, r, utils.AppURL("/oauth/callback?"+params.Encode()), http.StatusFound)
+}
+
+// setOIDCStateCookie stores a hash of the state in the browser, so a callback
+// only succeeds in the browser that started the login. The cookie is set on a
+// top-level navigation to this server, so Lax is enough for browsers to keep
+// it and to send it with the provider's redirect back to the callback.
+func setOIDCStateCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   oidcCookieSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// oidcCookieSecure reports whether the state cookie needs the Secure flag:
+// whenever the server is reached over HTTPS, including through a proxy that
+// terminates TLS, which API_URL reveals
+func oidcCookieSecure(r *http.Request) bool {
+	return r.TLS != nil || strings.HasPrefix(utils.APIURL(""), "https://")
+}
+
+// validOIDCStateCookie reports whether the request carries the cookie set for state
+func validOIDCStateCookie(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(utils.HashToken(state))) == 1
+}
+
+// oidcLinkStart is the signed link intent StartOIDCLinkHandler hands out
+type oidcLinkStart struct {
+	UserID int `json:"u"`
+}
+
+// ListOIDCProvidersHandler lists the identity providers users can sign in with
+func ListOIDCProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"providers": oidc.Names()})
+}
+
+// StartOIDCLinkHandler lets the authenticated user link a provider account. It
+// returns a short-lived start URL to open in the browser, which carries the
+// user's identity to StartOIDCLoginHandler; the link still has to be
+// confirmed with ConfirmOIDCLinkHandler afterwards.
+func StartOIDCLinkHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+	provider, ok := oidc.Get(mux.Vars(r)["provider"])
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	token, err := utils.SignToken(oidcLinkStartPurpose, oidcLinkStart{UserID: user.ID}, oidcLinkStartTTL)
+	if err != nil {
+		http.Error(w, "Error starting link", http.StatusInternalServerError)
+		return
+	}
+
+	startURL := utils.APIURL("/api/auth/oidc/" + url.PathEscape(provider.Name) + "/start?" + url.Values{"link": {token}}.Encode())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.OIDCLinkStartResponse{StartURL: startURL})
+}
+
+// StartOIDCLoginHandler begins a login at an identity provider. The browser
+// opens it directly (not with fetch), so the state cookie is set by this
+// server as a first party; it is then redirected to the provider. With a
+// link parameter from StartOIDCLinkHandler the provider account is linked to
+// that user instead of logging in. Errors are reported to the frontend's
+// callback page.
+func StartOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oidc.Get(mux.Vars(r)["provider"])
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	var linkUserID *int
+	if link := r.URL.Query().Get("link"); link != "" {
+		var intent oidcLinkStart
+		if err := utils.VerifySignedToken(oidcLinkStartPurpose, link, &intent); err != nil {
+			oidcRedirect(w, r, url.Values{"error": {"invalid_link"}})
+			return
+		}
+		linkUserID = &intent.UserID
+	}
+
+	state, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+	nonce, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+	verifier, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error starting OIDC login with %s: %v", provider.Name, err)
+		oidcRedirect(w, r, url.Values{"error": {"provider_unavailable"}})
+		return
+	}
+
+	// Forget abandoned logins
+	_, err = database.DBPool.Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW() - INTERVAL '1 day'`)
+	if err != nil {
+		log.Printf("Error pruning OIDC login states: %v", err)
+	}
+
+	_, err = database.DBPool.Exec(ctx, `
+		INSERT INTO oidc_login_states (state_hash, provider, code_verifier, nonce, link_user_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, utils.HashToken(state), provider.Name, verifier, nonce, linkUserID, time.Now().Add(oidcStateTTL))
+	if err != nil {
+		log.Printf("Error saving OIDC login state: %v", err)
+		oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	setOIDCStateCookie(w, r, utils.HashToken(state), int(oidcStateTTL/time.Second))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler receives the browser back from the identity provider,
+// redeems the authorization code and redirects to the frontend with either a
+// result token for CompleteOIDCLoginHandler, a link token for
+// ConfirmOIDCLinkHandler or an error code. Callbacks without the state cookie
+// set by StartOIDCLoginHandler are rejected, so an attacker cannot finish
+// their own login in someone else's browser.
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oidc.Get(mux.Vars(r)["provider"])
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	stateMatches := validOIDCStateCookie(r, query.Get("state"))
+	setOIDCStateCookie(w, r, "", -1)
+	if providerError := query.Get("error"); providerError != "" {
+		oidcRedirect(w, r, url.Values{"error": {providerError}})
+		return
+	}
+
+	if !stateMatches {
+		oidcRedirect(w, r, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	// Consume the state so the callback cannot be replayed
+	var stateID int
+	var verifier, nonce string
+	var linkUserID *int
+	err := database.DBPool.QueryRow(ctx, `
+		UPDATE oidc_login_states SET callback_at = NOW()
+		WHERE state_hash = $1 AND provider = $2 AND callback_at IS NULL AND expires_at > NOW()
+		RETURNING id, code_verifier, nonce, link_user_id
+	`, utils.HashToken(query.Get("state")), provider.Name).Scan(&stateID, &verifier, &nonce, &linkUserID)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Error reading OIDC login state: %v", err)
+		}
+		oidcRedirect(w, r, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, query.Get("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("OIDC login with %s failed: %v", provider.Name, err)
+		oidcRedirect(w, r, url.Values{"error": {"provider_error"}})
+		return
+	}
+
+	result := oidcResult{StateID: stateID, Provider: provider.Name}
+	if linkUserID != nil {
+		// Linking waits for the signed-in user to confirm it
+		result.UserID = *linkUserID
+		result.Subject = identity.Subject
+		result.Email = identity.Email
+		token, err := utils.SignToken(oidcLinkPurpose, result, oidcStateTTL)
+		if err != nil {
+			oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+			return
+		}
+		oidcRedirect(w, r, url.Values{"link_token": {token}, "provider": {provider.Name}})
+		return
+	}
+
+	var userID int
+	err = database.DBPool.QueryRow(ctx, `
+		UPDATE user_identities SET last_login_at = NOW(), email = $3
+		WHERE provider = $1 AND subject = $2
+		RETURNING user_id
+	`, provider.Name, identity.Subject, identity.Email).Scan(&userID)
+	switch {
+	case err == nil:
+		result.UserID = userID
+	case errors.Is(err, pgx.ErrNoRows):
+		// First login with this provider account: the frontend asks for a username
+		result.Subject = identity.Subject
+		result.Email = identity.Email
+		result.EmailVerified = identity.EmailVerified
+		result.Suggested = suggestUsername(identity)
+	default:
+		log.Printf("Error looking up OIDC identity: %v", err)
+		oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	token, err := utils.SignToken(oidcResultPurpose, result, oidcStateTTL)
+	if err != nil {
+		oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+	oidcRedirect(w, r, url.Values{"token": {token}})
+}
+
+// ConfirmOIDCLinkHandler attaches the provider account from a link token to
+// the authenticated user, who must be the one that started the link
+func ConfirmOIDCLinkHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req models.OIDCCompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	var result oidcResult
+	if err := utils.VerifySignedToken(oidcLinkPurpose, req.Token, &result); err != nil || result.UserID != user.ID {
+		http.Error(w, "Link expired, please try again", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	res, err := tx.Exec(ctx, `
+		UPDATE oidc_login_states SET completed_at = NOW()
+		WHERE id = $1 AND provider = $2 AND link_user_id = $3 AND completed_at IS NULL
+	`, result.StateID, result.Provider, user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		http.Error(w, "Link already completed, please try again", http.StatusUnauthorized)
+		return
+	}
+
+	var ownerID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, subject) DO UPDATE SET email = EXCLUDED.email
+		RETURNING user_id
+	`, user.ID, result.Provider, result.Subject, result.Email).Scan(&ownerID)
+	if err != nil {
+		log.Printf("Error linking OIDC identity: %v", err)
+		http.Error(w, "Error linking account", http.StatusInternalServerError)
+		return
+	}
+	if ownerID != user.ID {
+		http.Error(w, "This "+result.Provider+" account is linked to another user", http.StatusConflict)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error linking account", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account linked", "provider": result.Provider})
+}
+
+// CompleteOIDCLoginHandler redeems the token from OIDCCallbackHandler. A
+// returning user is signed in (or asked for their two-factor code). For a new
+// provider account, a username is required; without one the response asks
+// for it, and the same token can be sent again with the chosen username.
+func CompleteOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.OIDCCompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	var result oidcResult
+	if err := utils.VerifySignedToken(oidcResultPurpose, req.Token, &result); err != nil {
+		http.Error(w, "Login expired, please try again", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// The state is only marked complete if the transaction commits, so a
+	// taken username can be corrected and the token sent again
+	var stateID int
+	err = tx.QueryRow(ctx, `
+		UPDATE oidc_login_states SET completed_at = NOW()
+		WHERE id = $1 AND provider = $2 AND completed_at IS NULL
+		RETURNING id
+	`, result.StateID, result.Provider).Scan(&stateID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Login already completed, please try again", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if result.UserID != 0 {
+		completeOIDCLogin(ctx, w, r, tx, result.UserID)
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.OIDCSignupRequired{
+			UsernameRequired:  true,
+			Provider:          result.Provider,
+			Email:             result.Email,
+			SuggestedUsername: result.Suggested,
+		})
+		return
+	}
+	if len(username) > maxUsernameLength {
+		http.Error(w, "Username is too long", http.StatusBadRequest)
+		return
+	}
+	if result.Email == "" {
+		http.Error(w, "The login provider did not share an email address", http.StatusBadRequest)
+		return
+	}
+
+	var emailTaken bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))`, result.Email).Scan(&emailTaken)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if emailTaken {
+		// Linking by email alone would let anyone controlling that address at the provider take the account over
+		http.Error(w, "An account with this email already exists. Sign in with your password and link "+result.Provider+" from your settings.", http.StatusConflict)
+		return
+	}
+
+	// Accounts created through a provider have no password until they reset one
+	user := models.User{Username: username, Email: strings.ToLower(result.Email), Role: models.RoleUser}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (username, email, password_hash, verified_at)
+		VALUES ($1, $2, '', CASE WHEN $3 THEN NOW() END)
+		RETURNING id
+	`, user.Username, user.Email, result.EmailVerified).Scan(&user.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "Username already taken", http.StatusConflict)
+			return
+		}
+		log.Printf("Error creating user from OIDC login: %v", err)
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW())
+	`, user.ID, result.Provider, result.Subject, result.Email)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "This account is already linked, please sign in again", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+
+	verified := result.EmailVerified
+	user.EmailVerified = &verified
+	if !verified {
+		if err := sendVerificationEmail(user.ID, user.Username, user.Email); err != nil {
+			log.Printf("Error creating verification link for user %d: %v", user.ID, err)
+		}
+	}
+
+	resp, err := startSession(ctx, r, user)
+	if err != nil {
+		http.Error(w, "Error generating authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// completeOIDCLogin signs in a returning user once their state has been consumed in tx
+func completeOIDCLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, tx pgx.Tx, userID int) {
+	var user models.User
+	var suspended, verified, twoFactor bool
+	err := tx.QueryRow(ctx, `
+		SELECT id, username, email, role, suspended_at IS NOT NULL, verified_at IS NOT NULL, totp_enabled_at IS NOT NULL
+		FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &suspended, &verified, &twoFactor)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Login expired, please try again", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if suspended {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	// The provider replaces the password, not the second factor
+	if twoFactor {
+		writeLoginChallenge(w, user.ID)
+		return
+	}
+
+	user.EmailVerified = &verified
+	resp, err := startSession(ctx, r, user)
+	if err != nil {
+		http.Error(w, "Error generating authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListIdentitiesHandler lists the provider accounts linked to the authenticated user
+func ListIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT id, provider, email, created_at, last_login_at
+		FROM user_identities WHERE user_id = $1
+		ORDER BY created_at
+	`, user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	identities := []models.LinkedIdentity{}
+	for rows.Next() {
+		var identity models.LinkedIdentity
+		var createdAt time.Time
+		var lastLoginAt *time.Time
+		if err := rows.Scan(&identity.ID, &identity.Provider, &identity.Email, &createdAt, &lastLoginAt); err != nil {
+			http.Error(w, "Error parsing identities", http.StatusInternalServerError)
+			return
+		}
+		identity.CreatedAt = createdAt.Format(time.RFC3339)
+		if lastLoginAt != nil {
+			identity.LastLoginAt = lastLoginAt.Format(time.RFC3339)
+		}
+		identities = append(identities, identity)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"identities": identities})
+}
+
+// UnlinkIdentityHandler removes a linked provider account, unless it is the
+// user's only way to sign in
+func UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	identityID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid identity ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var hasPassword bool
+	var otherIdentities int
+	err = tx.QueryRow(ctx, `
+		SELECT password_hash <> '',
+		       (SELECT COUNT(*) FROM user_identities WHERE user_id = $1 AND id <> $2)
+		FROM users WHERE id = $1
+		FOR UPDATE
+	`, user.ID, identityID).Scan(&hasPassword, &otherIdentities)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := tx.Exec(ctx, `DELETE FROM user_identities WHERE id = $1 AND user_id = $2`, identityID, user.ID)
+	if err != nil {
+		http.Error(w, "Error unlinking account", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		http.Error(w, "Linked account not found", http.StatusNotFound)
+		return
+	}
+	if !hasPassword && otherIdentities == 0 {
+		http.Error(w, "Set a password before unlinking your only sign-in method", http.StatusBadRequest)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error unlinking account", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account unlinked"})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"project/server/oidc"
+	"project/server/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSetOIDCStateCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiURL string
+		secure bool
+	}{
+		{"behind a TLS proxy", "https://api.example.com", true},
+		{"local development", "http://localhost:8080", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_URL", tt.apiURL)
+			rec := httptest.NewRecorder()
+			setOIDCStateCookie(rec, httptest.NewRequest(http.MethodGet, "http://internal/api/auth/oidc/dev/start", nil), "hash", 600)
+
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("set %d cookies, want 1", len(cookies))
+			}
+			c := cookies[0]
+			if c.Secure != tt.secure || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode || c.Path != "/api/auth/oidc" {
+				t.Errorf("cookie = %+v, want HttpOnly, Lax, Secure %v on /api/auth/oidc", c, tt.secure)
+			}
+		})
+	}
+}
+
+func TestValidOIDCStateCookie(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/dev/callback", nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: utils.HashToken("state-1")})
+
+	if !validOIDCStateCookie(req, "state-1") {
+		t.Error("cookie for the state was rejected")
+	}
+	if validOIDCStateCookie(req, "state-2") {
+		t.Error("cookie for another state was accepted")
+	}
+	if validOIDCStateCookie(req, "") {
+		t.Error("empty state was accepted")
+	}
+	if validOIDCStateCookie(httptest.NewRequest(http.MethodGet, "/", nil), "state-1") {
+		t.Error("request without the cookie was accepted")
+	}
+}
+
+func TestStartOIDCLoginRejectsForgedLink(t *testing.T) {
+	t.Setenv("APP_URL", "https://app.example.com")
+	t.Setenv("OIDC_PROVIDERS", "dev")
+	t.Setenv("OIDC_DEV_ISSUER", "http://localhost:9000")
+	t.Setenv("OIDC_DEV_CLIENT_ID", "arouzy")
+	oidc.LoadProviders("http://localhost:8080/api/auth/oidc")
+	t.Cleanup(func() {
+		t.Setenv("OIDC_PROVIDERS", "")
+		oidc.LoadProviders("")
+	})
+
+	// A link intent signed for another purpose must not start a link
+	forged, err := utils.SignToken(oidcLinkPurpose, oidcLinkStart{UserID: 1}, oidcLinkStartTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"garbage", forged} {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/dev/start?link="+link, nil)
+		req = mux.SetURLVars(req, map[string]string{"provider": "dev"})
+		rec := httptest.NewRecorder()
+		StartOIDCLoginHandler(rec, req)
+
+		location := rec.Header().Get("Location")
+		if rec.Code != http.StatusFound || !strings.HasPrefix(location, "https://app.example.com/oauth/callback?error=invalid_link") {
+			t.Errorf("start with link %.10q = %d %s, want a redirect with invalid_link", link, rec.Code, location)
+		}
+		if len(rec.Result().Cookies()) != 0 {
+			t.Error("state cookie set for a rejected link")
+		}
+	}
+}
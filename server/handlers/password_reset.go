@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"project/server/database"
+	"project/server/mail"
+	"project/server/middleware"
+	"project/server/models"
+	"project/server/utils"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTTL is how long an emailed reset link stays valid
+const passwordResetTTL = time.Hour
+
+// ForgotPasswordHandler emails a password reset link. It responds the same
+// way whether or not the address belongs to an account, so it cannot be used
+// to find out who is registered. Requests are limited per address and per
+// client IP, whether or not an account exists.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	accountKey := resetAccountThrottleKey(email)
+	ipKey := resetIPThrottleKey(utils.ClientIP(r))
+	retryAfter, err := throttleRetryAfter(ctx, accountKey, ipKey)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		setRetryAfter(w, retryAfter)
+		http.Error(w, "Too many password reset requests, please try again later", http.StatusTooManyRequests)
+		return
+	}
+	countThrottleFailure(ctx, accountKey, resetAccountThrottle)
+	countThrottleFailure(ctx, ipKey, resetIPThrottle)
+
+	// Look up the account, create the token and send it in the background, so
+	// response time does not reveal whether the account exists
+	go sendPasswordReset(email)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account exists for that email, a reset link has been sent",
+	})
+}
+
+// resetAccountThrottleKey returns the throttle key of reset emails to an address
+func resetAccountThrottleKey(email string) string {
+	return "reset-account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// resetIPThrottleKey returns the throttle key of reset requests from a client address
+func resetIPThrottleKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+// sendPasswordReset emails a reset link to the account with email, if there
+// is an active one
+func sendPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var userID int
+	var username string
+	err := database.DBPool.QueryRow(ctx, `
+		SELECT id, username FROM users WHERE LOWER(email) = LOWER($1) AND suspended_at IS NULL
+	`, email).Scan(&userID, &username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up account for password reset: %v", err)
+		return
+	}
+
+	token, err := createPasswordResetToken(ctx, userID)
+	if err != nil {
+		log.Printf("Error creating password reset token for user %d: %v", userID, err)
+		return
+	}
+
+	msg := mail.Message{
+		To:      email,
+		Subject: "Reset your Arouzy password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+			"Use this link within the next hour to choose a new one:\n\n%s\n\n"+
+			"If it wasn't you, you can ignore this email; your password has not changed.\n",
+			username, utils.AppURL("/reset-password?token="+url.QueryEscape(token))),
+	}
+	if err := mail.Send(msg); err != nil {
+		log.Printf("Error sending password reset email to user %d: %v", userID, err)
+	}
+}
+
+// createPasswordResetToken stores a new reset token for a user, invalidating
+// any earlier ones, and returns the token to email
+func createPasswordResetToken(ctx context.Context, userID int) (string, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, utils.HashToken(token), time.Now().Add(passwordResetTTL))
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetPasswordHandler sets a new password using a reset token. The token can
+// only be used once, and every existing session of the account is signed out.
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		http.Error(w, "Token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Error processing password", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var tokenID, userID int
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`, utils.HashToken(req.Token)).Scan(&tokenID, &userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1`, tokenID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2
+	`, string(hashedPassword), userID)
+	if err != nil {
+		log.Printf("Error resetting password for user %d: %v", userID, err)
+		http.Error(w, "Error updating password", http.StatusInternalServerError)
+		return
+	}
+
+	sessionIDs, err := revokeUserSessions(ctx, tx, userID, 0)
+	if err != nil {
+		http.Error(w, "Error updating password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error updating password", http.StatusInternalServerError)
+		return
+	}
+	for _, sessionID := range sessionIDs {
+		middleware.SetSessionRevoked(sessionID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset"})
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/server/database"
+	"project/server/models"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// contentReportThreshold is the number of open reports that hides content until a moderator reviews it
+const contentReportThreshold = 3
+
+// reportTarget checks that a report target exists; queries that restrict
+// visibility take the reporter's user ID as $2
+type reportTarget struct {
+	query        string
+	withReporter bool
+}
+
+// reportTargets are the item types that can be reported
+var reportTargets = map[string]reportTarget{
+	"content":         {query: `SELECT EXISTS(SELECT 1 FROM content WHERE id = $1 AND moderation_status <> 'removed')`},
+	"trading_content": {query: `SELECT EXISTS(SELECT 1 FROM trading_content WHERE id = $1)`},
+	"collection":      {query: `SELECT EXISTS(SELECT 1 FROM collections WHERE id = $1 AND (is_public OR user_id = $2))`, withReporter: true},
+	"message":         {query: `SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND (from_user_id = $2 OR to_user_id = $2))`, withReporter: true},
+	"comment":         {query: `SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND deleted_at IS NULL)`},
+}
+
+// reportReasons are the accepted reason codes; severe ones hide content immediately
+var reportReasons = map[string]bool{
+	"spam":           false,
+	"harassment":     false,
+	"non_consensual": true,
+	"underage":       true,
+	"copyright":      false,
+	"illegal":        true,
+	"other":          false,
+}
+
+// CreateReportHandler lets the authenticated user flag an item for moderation
+func CreateReportHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req models.CreateReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	target, ok := reportTargets[req.TargetType]
+	if !ok {
+		http.Error(w, "Invalid target type", http.StatusBadRequest)
+		return
+	}
+	severe, ok := reportReasons[req.Reason]
+	if !ok {
+		http.Error(w, "Invalid reason", http.StatusBadRequest)
+		return
+	}
+	if req.TargetID == 0 {
+		http.Error(w, "Target ID is required", http.StatusBadRequest)
+		return
+	}
+	req.Details = strings.TrimSpace(req.Details)
+	if req.Reason == "other" && req.Details == "" {
+		http.Error(w, "Details are required for reason 'other'", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Check if target exists and is visible to the reporter
+	targetArgs := []interface{}{req.TargetID}
+	if target.withReporter {
+		targetArgs = append(targetArgs, user.ID)
+	}
+	var targetExists bool
+	if err := database.DBPool.QueryRow(ctx, target.query, targetArgs...).Scan(&targetExists); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !targetExists {
+		http.Error(w, "Report target not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var report models.Report
+	var createdAt time.Time
+	err = tx.QueryRow(ctx, `
+		INSERT INTO reports (reporter_id, target_type, target_id, reason, details)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at
+	`, user.ID, req.TargetType, req.TargetID, req.Reason, req.Details).Scan(&report.ID, &report.Status, &createdAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "You have already reported this item", http.StatusConflict)
+			return
+		}
+		log.Printf("Error creating report: %v", err)
+		http.Error(w, "Error creating report", http.StatusInternalServerError)
+		return
+	}
+
+	// Hide reported content until reviewed once it is reported often or severely enough
+	if req.TargetType == "content" {
+		_, err = tx.Exec(ctx, `
+			UPDATE content SET moderation_status = 'pending'
+			WHERE id = $1 AND moderation_status = 'approved'
+			AND ($2 OR (SELECT COUNT(*) FROM reports WHERE target_type = 'content' AND target_id = $1 AND status = 'open') >= $3)
+		`, req.TargetID, severe, contentReportThreshold)
+		if err != nil {
+			log.Printf("Error updating moderation status: %v", err)
+			http.Error(w, "Error creating report", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error creating report", http.StatusInternalServerError)
+		return
+	}
+
+	report.ReporterID = user.ID
+	report.TargetType = req.TargetType
+	report.TargetID = req.TargetID
+	report.Reason = req.Reason
+	report.Details = req.Details
+	report.CreatedAt = createdAt.Format(time.RFC3339)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// ListReportsHandler lists reports for moderators, open ones by default
+func ListReportsHandler(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+
+	page, err := strconv.Atoi(queryParams.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit := parsePageSize(queryParams.Get("limit"))
+	offset := (page - 1) * limit
+
+	status := queryParams.Get("status")
+	if status == "" {
+		status = "open"
+	}
+
+	whereClause := "WHERE r.status = $1 "
+	args := []interface{}{status}
+	argPosition := 2
+
+	if targetType := queryParams.Get("targetType"); targetType != "" {
+		whereClause += fmt.Sprintf("AND r.target_type = $%d ", argPosition)
+		args = append(args, targetType)
+		argPosition++
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT r.id, COALESCE(r.reporter_id, 0), COALESCE(u.username, ''), r.target_type, r.target_id,
+		       r.reason, COALESCE(r.details, ''), r.status, r.resolved_by, r.resolved_at,
+		       COALESCE(r.resolution_note, ''), r.created_at
+		FROM reports r
+		LEFT JOIN users u ON r.reporter_id = u.id
+		`+whereClause+`
+		ORDER BY r.created_at ASC, r.id ASC
+		`+fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset),
+		args...)
+	if err != nil {
+		log.Printf("Error querying reports: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	reports := []models.Report{}
+	for rows.Next() {
+		var report models.Report
+		var createdAt time.Time
+		var resolvedAt *time.Time
+		err := rows.Scan(
+			&report.ID,
+			&report.ReporterID,
+			&report.Reporter,
+			&report.TargetType,
+			&report.TargetID,
+			&report.Reason,
+			&report.Details,
+			&report.Status,
+			&report.ResolvedBy,
+			&resolvedAt,
+			&report.ResolutionNote,
+			&createdAt,
+		)
+		if err != nil {
+			http.Error(w, "Error parsing reports", http.StatusInternalServerError)
+			return
+		}
+		report.CreatedAt = createdAt.Format(time.RFC3339)
+		if resolvedAt != nil {
+			report.ResolvedAt = resolvedAt.Format(time.RFC3339)
+		}
+		reports = append(reports, report)
+	}
+
+	var totalItems int
+	err = database.DBPool.QueryRow(ctx, "SELECT COUNT(*) FROM reports r "+whereClause, args...).Scan(&totalItems)
+	if err != nil {
+		http.Error(w, "Error counting reports", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.ReportResponse{
+		Reports: reports,
+		Pagination: models.Pagination{
+			CurrentPage:  page,
+			TotalPages:   (totalItems + limit - 1) / limit,
+			TotalItems:   totalItems,
+			ItemsPerPage: limit,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ResolveReportHandler records a moderator's decision on a report. The decision
+// applies to every open report on the same target; upholding removes content
+// and comments, dismissing restores content hidden while pending.
+func ResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	reportID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ResolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	switch req.Action {
+	case "uphold":
+		status = "upheld"
+	case "dismiss":
+		status = "dismissed"
+	default:
+		http.Error(w, "Action must be 'uphold' or 'dismiss'", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var targetType, currentStatus string
+	var targetID int
+	err = tx.QueryRow(ctx, `
+		SELECT target_type, target_id, status FROM reports WHERE id = $1 FOR UPDATE
+	`, reportID).Scan(&targetType, &targetID, &currentStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Report not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if currentStatus != "open" {
+		http.Error(w, "Report is already resolved", http.StatusConflict)
+		return
+	}
+
+	// Close every open report on the same target
+	res, err := tx.Exec(ctx, `
+		UPDATE reports SET status = $1, resolved_by = $2, resolved_at = NOW(), resolution_note = $3
+		WHERE target_type = $4 AND target_id = $5 AND status = 'open'
+	`, status, user.ID, req.Note, targetType, targetID)
+	if err != nil {
+		log.Printf("Error resolving report: %v", err)
+		http.Error(w, "Error resolving report", http.StatusInternalServerError)
+		return
+	}
+
+	// Apply the decision to the target itself
+	var effect string
+	switch {
+	case targetType == "content" && status == "upheld":
+		effect = `UPDATE content SET moderation_status = 'removed' WHERE id = $1`
+	case targetType == "content" && status == "dismissed":
+		effect = `UPDATE content SET moderation_status = 'approved' WHERE id = $1 AND moderation_status = 'pending'`
+	case targetType == "comment" && status == "upheld":
+		effect = `UPDATE comments SET body = '', deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+	}
+	if effect != "" {
+		if _, err := tx.Exec(ctx, effect, targetID); err != nil {
+			log.Printf("Error applying moderation decision: %v", err)
+			http.Error(w, "Error resolving report", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error resolving report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         "Report " + status,
+		"reportsResolved": res.RowsAffected(),
+	})
+}
+
+// UpdateContentModerationHandler lets a moderator set the moderation state of content directly
+func UpdateContentModerationHandler(w http.ResponseWriter, r *http.Request) {
+	contentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateModerationStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Status {
+	case "approved", "pending", "removed":
+	default:
+		http.Error(w, "Status must be 'approved', 'pending' or 'removed'", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DBPool.Exec(ctx, `
+		UPDATE content SET moderation_status = $1 WHERE id = $2
+	`, req.Status, contentID)
+	if err != nil {
+		log.Printf("Error updating moderation status: %v", err)
+		http.Error(w, "Error updating moderation status", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		http.Error(w, "Content not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Moderation status updated"})
+}
@@ -38,10 +38,17 @@ func SearchContentHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
+	// Flag items the calling user has upvoted (user ID 0 never matches)
+	var currentUserID int
+	if currentUser, ok := r.Context().Value(models.UserContextKey).(models.User); ok {
+		currentUserID = currentUser.ID
+	}
+
 	// Build the search query with ranking
 	query := `
-		SELECT DISTINCT c.id, c.title, c.description, c.image_count, c.video_count, c.thumbnail_url, c.created_at,
-			(SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) AS upvotes,
+		SELECT DISTINCT c.id, c.title, c.description, c.image_count, c.video_count, `+contentThumbnailSQL+`, c.created_at,
+			c.upvote_count AS upvotes, c.comment_count,
+			EXISTS(SELECT 1 FROM upvotes WHERE content_id = c.id AND user_id = $4) AS has_upvoted,
 			u.id as user_id, u.username as user_username,
 			-- Calculate search relevance score
 			CASE 
@@ -55,7 +62,7 @@ func SearchContentHandler(w http.ResponseWriter, r *http.Request) {
 			END as relevance_score
 		FROM content c
 		JOIN users u ON c.user_id = u.id
-		WHERE (
+		WHERE c.moderation_status = 'approved' AND (
 			c.title ILIKE $3 OR 
 			c.description ILIKE $3 OR 
 			u.username ILIKE $3 OR
@@ -73,12 +80,12 @@ func SearchContentHandler(w http.ResponseWriter, r *http.Request) {
 	partialMatch := "%" + searchQuery + "%"
 	searchPattern := "%" + searchQuery + "%"
 
-	args := []interface{}{exactMatch, partialMatch, searchPattern}
+	args := []interface{}{exactMatch, partialMatch, searchPattern, currentUserID}
 
 	// Add ORDER BY for relevance and recency
 	orderClause := `
 		ORDER BY relevance_score DESC, 
-		(SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) DESC, 
+		c.upvote_count DESC, 
 		c.created_at DESC
 	`
 
@@ -114,6 +121,8 @@ func SearchContentHandler(w http.ResponseWriter, r *http.Request) {
 			&item.Thumbnail,
 			&createdAt,
 			&item.Upvotes,
+			&item.CommentCount,
+			&item.HasUpvoted,
 			&userID,
 			&username,
 			&relevanceScore,
@@ -169,6 +178,7 @@ func SearchContentHandler(w http.ResponseWriter, r *http.Request) {
 					images = append(images, image)
 				}
 			}
+			attachImageVariants(ctx, images)
 			item.Images = images
 		}
 
@@ -180,7 +190,7 @@ func SearchContentHandler(w http.ResponseWriter, r *http.Request) {
 		SELECT COUNT(DISTINCT c.id)
 		FROM content c
 		JOIN users u ON c.user_id = u.id
-		WHERE (
+		WHERE c.moderation_status = 'approved' AND (
 			c.title ILIKE $1 OR 
 			c.description ILIKE $1 OR 
 			u.username ILIKE $1 OR
@@ -211,6 +221,7 @@ func SearchContentHandler(w http.ResponseWriter, r *http.Request) {
 			TotalItems:   totalItems,
 			ItemsPerPage: limit,
 		},
+		HasMore: page < totalPages,
 	}
 
 	// Return response
@@ -239,12 +250,12 @@ func SearchSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Build the search query for suggestions
 	query := `
-		SELECT DISTINCT c.id, c.title, c.description, c.image_count, c.video_count, c.thumbnail_url, c.created_at,
-			(SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) AS upvotes,
+		SELECT DISTINCT c.id, c.title, c.description, c.image_count, c.video_count, `+contentThumbnailSQL+`, c.created_at,
+			c.upvote_count AS upvotes, c.comment_count,
 			u.id as user_id, u.username as user_username
 		FROM content c
 		JOIN users u ON c.user_id = u.id
-		WHERE (
+		WHERE c.moderation_status = 'approved' AND (
 			c.title ILIKE $1 OR 
 			c.description ILIKE $1 OR 
 			u.username ILIKE $1 OR
@@ -255,7 +266,7 @@ func SearchSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
 				WHERE t.name ILIKE $1
 			)
 		)
-		ORDER BY (SELECT COUNT(*) FROM upvotes WHERE content_id = c.id) DESC, c.created_at DESC
+		ORDER BY c.upvote_count DESC, c.created_at DESC
 		LIMIT $2
 	`
 
@@ -286,6 +297,7 @@ func SearchSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
 			&item.Thumbnail,
 			&createdAt,
 			&item.Upvotes,
+			&item.CommentCount,
 			&userID,
 			&username,
 		)
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project/server/database"
+	"project/server/middleware"
+	"project/server/models"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// ListSessionsHandler lists the authenticated user's active sessions, most recently used first
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+	currentSessionID, _ := r.Context().Value(models.SessionContextKey).(int)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT id, user_agent, ip_address, created_at, last_seen_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC, id DESC
+	`, user.ID)
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		var createdAt, lastSeenAt time.Time
+		if err := rows.Scan(&session.ID, &session.UserAgent, &session.IPAddress, &createdAt, &lastSeenAt); err != nil {
+			http.Error(w, "Error parsing sessions", http.StatusInternalServerError)
+			return
+		}
+		session.CreatedAt = createdAt.Format(time.RFC3339)
+		session.LastSeenAt = lastSeenAt.Format(time.RFC3339)
+		session.Current = session.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"sessions": sessions})
+}
+
+// RevokeSessionHandler signs one of the authenticated user's sessions out
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var familyID string
+	err = tx.QueryRow(ctx, `
+		SELECT family_id FROM sessions
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		FOR UPDATE
+	`, sessionID, user.ID).Scan(&familyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if _, err := revokeTokenFamily(ctx, tx, familyID); err != nil {
+		log.Printf("Error revoking session %d: %v", sessionID, err)
+		http.Error(w, "Error revoking session", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error revoking session", http.StatusInternalServerError)
+		return
+	}
+	middleware.SetSessionRevoked(sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
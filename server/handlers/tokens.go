@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"project/server/database"
+	"project/server/middleware"
+	"project/server/models"
+	"project/server/utils"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// refreshTokenTTL is how long a refresh token can be exchanged; every
+// refresh issues a new one, so active users stay signed in indefinitely
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// errRefreshTokenInvalid is returned for unknown, expired, used or revoked refresh tokens
+var errRefreshTokenInvalid = errors.New("invalid refresh token")
+
+// checkRefreshToken decides whether a stored refresh token can be exchanged.
+// reused is true when the token was already rotated but its family is still
+// live, which means someone else holds a copy and the family must be revoked.
+func checkRefreshToken(used, revoked bool, expiresAt, now time.Time) (reused bool, err error) {
+	if used && !revoked {
+		return true, errRefreshTokenInvalid
+	}
+	if revoked || now.After(expiresAt) {
+		return false, errRefreshTokenInvalid
+	}
+	return false, nil
+}
+
+// newTokenFamily returns an identifier for a new chain of refresh tokens
+func newTokenFamily() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// issueTokens creates an access token for a session and stores a refresh token
+// in the session's family. parentID is the refresh token being rotated, or nil
+// for a new login.
+func issueTokens(ctx context.Context, tx pgx.Tx, user models.User, sessionID int, familyID string, parentID *int) (models.AuthResponse, error) {
+	token, err := utils.GenerateJWT(user, sessionID)
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, parent_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, user.ID, familyID, parentID, utils.HashToken(refreshToken), time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	return models.AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+		User:         user,
+	}, nil
+}
+
+// startSession records a new login session for the client making r and
+// issues its first access and refresh tokens
+func startSession(ctx context.Context, r *http.Request, user models.User) (models.AuthResponse, error) {
+	familyID, err := newTokenFamily()
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var sessionID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, family_id, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, user.ID, familyID, r.UserAgent(), utils.ClientIP(r), time.Now().Add(refreshTokenTTL)).Scan(&sessionID)
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	resp, err := issueTokens(ctx, tx, user, sessionID, familyID, nil)
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.AuthResponse{}, err
+	}
+	return resp, nil
+}
+
+// revokeTokenFamily revokes every refresh token in a family and the session
+// that owns it, returning the session's ID. Callers pass the ID to
+// middleware.SetSessionRevoked once the transaction commits.
+func revokeTokenFamily(ctx context.Context, tx pgx.Tx, familyID string) (int, error) {
+	_, err := tx.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID)
+	if err != nil {
+		return 0, err
+	}
+
+	var sessionID int
+	err = tx.QueryRow(ctx, `
+		UPDATE sessions SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE family_id = $1
+		RETURNING id
+	`, familyID).Scan(&sessionID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	return sessionID, nil
+}
+
+// revokeUserSessions revokes every session and refresh token of a user
+// except keepSessionID (0 to keep none), returning the IDs of the sessions
+// that were still active
+func revokeUserSessions(ctx context.Context, tx pgx.Tx, userID, keepSessionID int) ([]int, error) {
+	_, err := tx.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+		  AND family_id NOT IN (SELECT family_id FROM sessions WHERE id = $2)
+	`, userID, keepSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL AND id <> $2
+		RETURNING id
+	`, userID, keepSessionID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a
+// new refresh token. Presenting a token that was already exchanged means it
+// was copied, so the whole family is revoked and every holder must log in again.
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var tokenID, sessionID int
+	var familyID string
+	var expiresAt time.Time
+	var used, revoked bool
+	var user models.User
+	var suspended, verified bool
+	err = tx.QueryRow(ctx, `
+		SELECT rt.id, s.id, rt.family_id, rt.expires_at, rt.used_at IS NOT NULL, rt.revoked_at IS NOT NULL,
+		       u.id, u.username, u.email, u.role, u.suspended_at IS NOT NULL, u.verified_at IS NOT NULL
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.family_id = rt.family_id
+		JOIN users u ON u.id = rt.user_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt
+	`, utils.HashToken(req.RefreshToken)).Scan(
+		&tokenID, &sessionID, &familyID, &expiresAt, &used, &revoked,
+		&user.ID, &user.Username, &user.Email, &user.Role, &suspended, &verified,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, errRefreshTokenInvalid.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	reused, err := checkRefreshToken(used, revoked, expiresAt, time.Now())
+	if reused {
+		// Reuse of a rotated token: kill the whole chain
+		log.Printf("Refresh token reuse detected for user %d, revoking family %s", user.ID, familyID)
+		if _, err := revokeTokenFamily(ctx, tx, familyID); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		middleware.SetSessionRevoked(sessionID)
+		http.Error(w, errRefreshTokenInvalid.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if suspended {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+	user.EmailVerified = &verified
+
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, tokenID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Extend the session and record where it was last used from
+	_, err = tx.Exec(ctx, `
+		UPDATE sessions SET last_seen_at = NOW(), user_agent = $2, ip_address = $3, expires_at = $4
+		WHERE id = $1
+	`, sessionID, r.UserAgent(), utils.ClientIP(r), time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := issueTokens(ctx, tx, user, sessionID, familyID, &tokenID)
+	if err != nil {
+		log.Printf("Error rotating refresh token: %v", err)
+		http.Error(w, "Error generating authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// LogoutHandler ends the session the given refresh token belongs to
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var familyID string
+	err = tx.QueryRow(ctx, `
+		SELECT family_id FROM refresh_tokens WHERE token_hash = $1
+	`, utils.HashToken(req.RefreshToken)).Scan(&familyID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Logging out with an unknown token is a no-op
+	if err == nil {
+		sessionID, err := revokeTokenFamily(ctx, tx, familyID)
+		if err != nil {
+			http.Error(w, "Error logging out", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "Error logging out", http.StatusInternalServerError)
+			return
+		}
+		middleware.SetSessionRevoked(sessionID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+}
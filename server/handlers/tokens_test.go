@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	valid := now.Add(refreshTokenTTL)
+	expired := now.Add(-time.Second)
+
+	tests := []struct {
+		name      string
+		used      bool
+		revoked   bool
+		expiresAt time.Time
+		reused    bool
+		ok        bool
+	}{
+		{"fresh", false, false, valid, false, true},
+		{"rotated", true, false, valid, true, false},
+		{"rotated and expired", true, false, expired, true, false},
+		{"revoked family", false, true, valid, false, false},
+		{"reused after revocation", true, true, valid, false, false},
+		{"expired", false, false, expired, false, false},
+		{"expires now", false, false, now, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reused, err := checkRefreshToken(tt.used, tt.revoked, tt.expiresAt, now)
+			if reused != tt.reused {
+				t.Errorf("reused = %v, want %v", reused, tt.reused)
+			}
+			if tt.ok && err != nil {
+				t.Errorf("err = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, errRefreshTokenInvalid) {
+				t.Errorf("err = %v, want %v", err, errRefreshTokenInvalid)
+			}
+		})
+	}
+}
+
+func TestNewTokenFamily(t *testing.T) {
+	a, err := newTokenFamily()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newTokenFamily()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 32 || a == b {
+		t.Errorf("newTokenFamily() = %q, %q, want distinct 32-character IDs", a, b)
+	}
+}
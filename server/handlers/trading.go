@@ -3,18 +3,16 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"project/server/database"
 	"project/server/models"
-	"project/server/utils"
 )
 
 // UploadTradingContentHandler handles uploading new trading content (private)
@@ -40,18 +38,10 @@ func UploadTradingContentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Validate file type (reuse upload handler logic)
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	allowedExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".mp4", ".mov", ".avi", ".mkv", ".webm"}
-	isValid := false
-	for _, allowed := range allowedExtensions {
-		if ext == allowed {
-			isValid = true
-			break
-		}
-	}
-	if !isValid {
-		http.Error(w, "Invalid file type. Only images and videos are allowed.", http.StatusBadRequest)
+	// Validate the file's contents against its type
+	contentType, err := detectUploadType(file, header.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -59,28 +49,16 @@ func UploadTradingContentHandler(w http.ResponseWriter, r *http.Request) {
 	timestamp := time.Now().UnixNano()
 	filename := fmt.Sprintf("trading_%d_%s", timestamp, header.Filename)
 
-	// Ensure uploads directory exists
-	uploadDir := utils.GetUploadsDir()
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		http.Error(w, "Unable to create upload directory", http.StatusInternalServerError)
-		return
-	}
-
-	// Create destination file
-	dstPath := filepath.Join(uploadDir, filename)
-	dst, err := os.Create(dstPath)
+	// Store the file and record it as the user's upload
+	fileUrl, err := saveUpload(r.Context(), user.ID, file, "", filename, contentType)
 	if err != nil {
-		http.Error(w, "Unable to save file", http.StatusInternalServerError)
-		return
-	}
-	defer dst.Close()
-
-	// Copy file data
-	if _, err := file.Seek(0, 0); err == nil {
-		if _, err := dst.ReadFrom(file); err != nil {
-			http.Error(w, "Error saving file", http.StatusInternalServerError)
+		if errors.Is(err, errFileTypeMismatch) {
+			http.Error(w, errFileTypeMismatch.Error(), http.StatusBadRequest)
 			return
 		}
+		log.Printf("Error saving trading upload for user %d: %v", user.ID, err)
+		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		return
 	}
 
 	// Insert trading content into DB
@@ -88,7 +66,6 @@ func UploadTradingContentHandler(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	var id int
 	createdAt := time.Now().Format(time.RFC3339)
-	fileUrl := "/uploads/" + filename
 	err = database.DBPool.QueryRow(ctx,
 		`INSERT INTO trading_content (user_id, title, description, file_url, created_at, is_traded)
 		 VALUES ($1, $2, $3, $4, $5, false) RETURNING id`,
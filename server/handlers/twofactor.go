@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"project/server/database"
+	"project/server/models"
+	"project/server/utils"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// loginChallengePurpose scopes the signed token handed out between the two login steps
+	loginChallengePurpose = "login-2fa"
+	// loginChallengeTTL is how long a user has to enter their code after the password step
+	loginChallengeTTL = 5 * time.Minute
+	// totpIssuer is the account issuer shown in authenticator apps
+	totpIssuer = "Arouzy"
+	// recoveryCodeCount is how many recovery codes are generated at a time
+	recoveryCodeCount = 10
+)
+
+// loginChallengeClaims is the payload of a login challenge token
+type loginChallengeClaims struct {
+	UserID int `json:"u"`
+}
+
+// recoveryCodeAlphabet avoids characters that are easily confused when copied
+// by hand; its 32 characters map evenly onto random bytes
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz123456789"
+
+// normalizeRecoveryCode strips the separators and case users may type a code with
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// replaceRecoveryCodes discards a user's recovery codes and stores a new set,
+// returning the codes in the form shown to the user
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		for j := range buf {
+			buf[j] = recoveryCodeAlphabet[int(buf[j])%len(recoveryCodeAlphabet)]
+		}
+		code := string(buf[:5]) + "-" + string(buf[5:])
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, utils.HashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// verifySecondFactor checks a TOTP code or an unused recovery code for a user
+// with two-factor enabled, consuming it on success
+func verifySecondFactor(ctx context.Context, tx pgx.Tx, userID int, code string) (bool, error) {
+	var secret string
+	var lastStep int64
+	err := tx.QueryRow(ctx, `
+		SELECT totp_secret, totp_last_step FROM users
+		WHERE id = $1 AND totp_enabled_at IS NOT NULL
+		FOR UPDATE
+	`, userID).Scan(&secret, &lastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now(), lastStep); ok {
+		_, err := tx.Exec(ctx, `UPDATE users SET totp_last_step = $1 WHERE id = $2`, step, userID)
+		return err == nil, err
+	}
+
+	res, err := tx.Exec(ctx, `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE id = (
+			SELECT id FROM recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		)
+	`, userID, utils.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+// writeLoginChallenge responds to the password step of a login for an
+// account with two-factor enabled
+func writeLoginChallenge(w http.ResponseWriter, userID int) {
+	token, err := utils.SignToken(loginChallengePurpose, loginChallengeClaims{UserID: userID}, loginChallengeTTL)
+	if err != nil {
+		http.Error(w, "Error generating authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int(loginChallengeTTL.Seconds()),
+	})
+}
+
+// LoginTwoFactorHandler completes a login by exchanging the challenge token
+// from LoginHandler and a TOTP or recovery code for access and refresh tokens
+func LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ChallengeToken == "" || req.Code == "" {
+		http.Error(w, "Challenge token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	var claims loginChallengeClaims
+	if err := utils.VerifySignedToken(loginChallengePurpose, req.ChallengeToken, &claims); err != nil {
+		http.Error(w, "Login challenge expired, please sign in again", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var user models.User
+	var suspended, verified bool
+	err = tx.QueryRow(ctx, `
+		SELECT id, username, email, role, suspended_at IS NOT NULL, verified_at IS NOT NULL
+		FROM users WHERE id = $1
+	`, claims.UserID).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &suspended, &verified)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Login challenge expired, please sign in again", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Code guesses count against the same lockout as password guesses
+	clientIP := utils.ClientIP(r)
+	retryAfter, err := loginRetryAfter(ctx, user.Email, clientIP)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyLoginAttempts(w, retryAfter)
+		return
+	}
+
+	ok, err := verifySecondFactor(ctx, tx, user.ID, req.Code)
+	if err != nil {
+		log.Printf("Error verifying second factor for user %d: %v", user.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		tx.Rollback(ctx)
+		recordLoginFailure(ctx, user.Email, clientIP, &user.ID)
+		http.Error(w, "Invalid authentication code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if suspended {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+	user.EmailVerified = &verified
+	clearAccountThrottle(ctx, user.Email)
+
+	resp, err := startSession(ctx, r, user)
+	if err != nil {
+		http.Error(w, "Error generating authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SetupTwoFactorHandler generates a new TOTP secret for the authenticated
+// user. It takes effect once confirmed with ConfirmTwoFactorHandler.
+func SetupTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "Error generating secret", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var email string
+	err = database.DBPool.QueryRow(ctx, `
+		UPDATE users SET totp_secret = $1, totp_last_step = 0
+		WHERE id = $2 AND totp_enabled_at IS NULL
+		RETURNING email
+	`, secret, user.ID).Scan(&email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.TwoFactorSetupResponse{
+		Secret:     secret,
+		OtpauthURI: utils.TOTPURI(totpIssuer, email, secret),
+	})
+}
+
+// ConfirmTwoFactorHandler enables two-factor authentication once the user
+// proves their authenticator app produces valid codes, and returns their
+// recovery codes
+func ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var secret *string
+	var enabled bool
+	var lastStep int64
+	err = tx.QueryRow(ctx, `
+		SELECT totp_secret, totp_enabled_at IS NOT NULL, totp_last_step FROM users
+		WHERE id = $1
+		FOR UPDATE
+	`, user.ID).Scan(&secret, &enabled, &lastStep)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if secret == nil {
+		http.Error(w, "Two-factor setup has not been started", http.StatusBadRequest)
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(*secret, strings.TrimSpace(req.Code), time.Now(), lastStep)
+	if !valid {
+		http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW()
+		WHERE id = $2
+	`, step, user.ID)
+	if err != nil {
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, user.ID)
+	if err != nil {
+		log.Printf("Error generating recovery codes for user %d: %v", user.ID, err)
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodesHandler replaces the authenticated user's recovery
+// codes. A current TOTP or recovery code is required; wrong codes count
+// against the login lockout.
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var email string
+	if err := tx.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, user.ID).Scan(&email); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// A stolen access token must not allow unlimited code guesses
+	clientIP := utils.ClientIP(r)
+	retryAfter, err := loginRetryAfter(ctx, email, clientIP)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyLoginAttempts(w, retryAfter)
+		return
+	}
+
+	valid, err := verifySecondFactor(ctx, tx, user.ID, req.Code)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		tx.Rollback(ctx)
+		recordLoginFailure(ctx, email, clientIP, &user.ID)
+		http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, user.ID)
+	if err != nil {
+		log.Printf("Error generating recovery codes for user %d: %v", user.ID, err)
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off. Both the
+// password and a current TOTP or recovery code are required; wrong guesses
+// count against the login lockout.
+func DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req models.DisableTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Password == "" || req.Code == "" {
+		http.Error(w, "Password and code are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var passwordHash, email string
+	err = tx.QueryRow(ctx, `SELECT password_hash, email FROM users WHERE id = $1`, user.ID).Scan(&passwordHash, &email)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	clientIP := utils.ClientIP(r)
+	retryAfter, err := loginRetryAfter(ctx, email, clientIP)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyLoginAttempts(w, retryAfter)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)) != nil {
+		tx.Rollback(ctx)
+		recordLoginFailure(ctx, email, clientIP, &user.ID)
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	valid, err := verifySecondFactor(ctx, tx, user.ID, req.Code)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		tx.Rollback(ctx)
+		recordLoginFailure(ctx, email, clientIP, &user.ID)
+		http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+		WHERE id = $1
+	`, user.ID)
+	if err != nil {
+		http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, user.ID); err != nil {
+		http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
@@ -1,13 +1,24 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"project/server/utils"
+	"project/server/database"
+	"project/server/imaging"
+	"project/server/models"
+	"project/server/storage"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -35,6 +46,13 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Get user from context (set by AuthMiddleware)
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
 	// Parse multipart form with a max memory of 100 MB
 	if err := r.ParseMultipartForm(100 << 20); err != nil {
 		http.Error(w, "Error parsing form data", http.StatusBadRequest)
@@ -49,33 +67,24 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Validate file type
-	if !isValidFileType(header.Filename) {
-		http.Error(w, "Invalid file type. Only images and videos are allowed.", http.StatusBadRequest)
+	// Validate the file's contents against its type
+	contentType, err := detectUploadType(file, header.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Generate unique filename
 	filename := generateUniqueFilename(header.Filename)
 
-	// Ensure uploads directory exists
-	uploadDir := utils.GetUploadsDir()
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		http.Error(w, "Unable to create upload directory", http.StatusInternalServerError)
-		return
-	}
-
-	// Create destination file
-	dstPath := filepath.Join(uploadDir, filename)
-	dst, err := os.Create(dstPath)
+	// Store the file and record it as the user's upload
+	url, err := saveUpload(r.Context(), user.ID, file, "", filename, contentType)
 	if err != nil {
-		http.Error(w, "Unable to save file", http.StatusInternalServerError)
-		return
-	}
-	defer dst.Close()
-
-	// Copy file data
-	if _, err := io.Copy(dst, file); err != nil {
+		if errors.Is(err, errFileTypeMismatch) {
+			http.Error(w, errFileTypeMismatch.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error saving upload for user %d: %v", user.ID, err)
 		http.Error(w, "Error saving file", http.StatusInternalServerError)
 		return
 	}
@@ -83,9 +92,9 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	// Build response with file URL
 	resp := UploadResponse{
 		Filename: filename,
-		URL:      "/uploads/" + filename,
+		URL:      url,
 	}
-	
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
@@ -101,16 +110,16 @@ func MultipleUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse multipart form with a max memory of 200 MB
-	if err := r.ParseMultipartForm(200 << 20); err != nil {
-		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+	// Get user from context (set by AuthMiddleware)
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
 		return
 	}
 
-	// Ensure uploads directory exists
-	uploadDir := utils.GetUploadsDir()
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		http.Error(w, "Unable to create upload directory", http.StatusInternalServerError)
+	// Parse multipart form with a max memory of 200 MB
+	if err := r.ParseMultipartForm(200 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
 		return
 	}
 
@@ -120,45 +129,36 @@ func MultipleUploadHandler(w http.ResponseWriter, r *http.Request) {
 	// Process all files in the form
 	for _, files := range r.MultipartForm.File {
 		for _, header := range files {
-			// Validate file type
-			if !isValidFileType(header.Filename) {
-				continue // Skip invalid files
-			}
-
 			// Open the file
 			file, err := header.Open()
 			if err != nil {
 				continue // Skip files that can't be opened
 			}
 
-			// Generate unique filename
-			filename := generateUniqueFilename(header.Filename)
-
-			// Create destination file
-			dstPath := filepath.Join(uploadDir, filename)
-			dst, err := os.Create(dstPath)
+			// Validate the file's contents against its type
+			contentType, err := detectUploadType(file, header.Filename)
 			if err != nil {
 				file.Close()
-				continue // Skip files that can't be created
+				continue // Skip invalid files
 			}
 
-			// Copy file data
-			if _, err := io.Copy(dst, file); err != nil {
-				file.Close()
-				dst.Close()
-				continue // Skip files that can't be copied
-			}
+			// Generate unique filename
+			filename := generateUniqueFilename(header.Filename)
 
-			// Close files
+			// Store the file and record it as the user's upload
+			url, err := saveUpload(r.Context(), user.ID, file, "", filename, contentType)
 			file.Close()
-			dst.Close()
+			if err != nil {
+				log.Printf("Error saving upload for user %d: %v", user.ID, err)
+				continue // Skip files that can't be saved
+			}
 
 			// Add to response
 			uploadedFiles = append(uploadedFiles, UploadResponse{
 				Filename: filename,
-				URL:      "/uploads/" + filename,
+				URL:      url,
 			})
-			uploadedURLs = append(uploadedURLs, "/uploads/"+filename)
+			uploadedURLs = append(uploadedURLs, url)
 		}
 	}
 
@@ -172,22 +172,6 @@ func MultipleUploadHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// isValidFileType checks if the file type is allowed
-func isValidFileType(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	allowedExtensions := []string{
-		".jpg", ".jpeg", ".png", ".gif", ".webp", // Images
-		".mp4", ".mov", ".avi", ".mkv", ".webm", // Videos
-	}
-
-	for _, allowed := range allowedExtensions {
-		if ext == allowed {
-			return true
-		}
-	}
-	return false
-}
-
 // generateUniqueFilename creates a unique filename to prevent conflicts
 func generateUniqueFilename(originalName string) string {
 	ext := filepath.Ext(originalName)
@@ -196,6 +180,138 @@ func generateUniqueFilename(originalName string) string {
 	return fmt.Sprintf("%s_%d%s", name, timestamp, ext)
 }
 
+// saveUpload stores src (inside subdir, if set) as filename and records it in
+// the uploads table as owned by userID with its detected contentType. Image
+// metadata is stripped first; images too malformed for that fail with
+// errFileTypeMismatch. It returns the file's URL. The stored object is
+// removed again if it cannot be recorded.
+func saveUpload(ctx context.Context, userID int, src io.Reader, subdir, filename, contentType string) (string, error) {
+	// Photos lose their EXIF, XMP and IPTC metadata (location, device serials)
+	// before they are stored
+	if strings.HasPrefix(contentType, "image/") {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return "", fmt.Errorf("error reading file: %v", err)
+		}
+		stripped, err := imaging.StripMetadata(data, contentType)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errFileTypeMismatch, err)
+		}
+		src = bytes.NewReader(stripped)
+	}
+
+	// Spool the file to disk, hashing it on the way, so its size is known
+	// before it is handed to storage
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return "", fmt.Errorf("unable to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if err != nil {
+		return "", fmt.Errorf("error writing file: %v", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("error writing file: %v", err)
+	}
+
+	key := filename
+	if subdir != "" {
+		key = subdir + "/" + filename
+	}
+
+	if err := storage.Default.Put(ctx, key, tmp, size, contentType); err != nil {
+		return "", fmt.Errorf("error storing file: %v", err)
+	}
+	url := storage.Default.URL(key)
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err = database.DBPool.Exec(dbCtx, `
+		INSERT INTO uploads (user_id, url, size_bytes, mime_type, checksum)
+		VALUES ($1, $2, $3, $4, $5)
+	`, userID, url, size, contentType, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		if delErr := storage.Default.Delete(context.Background(), key); delErr != nil {
+			log.Printf("Error removing unrecorded upload %s: %v", key, delErr)
+		}
+		return "", fmt.Errorf("error recording upload: %v", err)
+	}
+
+	// Resized copies are made in the background
+	if isResizableImage(contentType) {
+		queueImageVariants()
+	}
+	return url, nil
+}
+
+// ServeUploadHandler serves stored files under /uploads/ (with the prefix
+// already stripped). Files in local storage support range requests; other
+// backends are streamed whole.
+func ServeUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := r.URL.Path
+	if !storage.ValidKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, info, err := storage.Default.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading stored file %s: %v", key, err)
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	// Serve the type detected at upload time and stop browsers from guessing
+	// another one, so a file can never be rendered as a page
+	w.Header().Set("Content-Type", uploadContentType(r.Context(), storage.UploadsPath+key, info.ContentType))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime, seeker)
+		return
+	}
+
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		io.Copy(w, body)
+	}
+}
+
+// uploadContentType returns the content type recorded for an upload, or
+// fallback for files stored before uploads were recorded
+func uploadContentType(ctx context.Context, url, fallback string) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var contentType string
+	err := database.DBPool.QueryRow(ctx, `SELECT mime_type FROM uploads WHERE url = $1`, url).Scan(&contentType)
+	if err != nil || contentType == "" {
+		return fallback
+	}
+	return contentType
+}
+
 // MessageAttachmentHandler handles file uploads for chat messages
 func MessageAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	// Set response content type
@@ -207,6 +323,13 @@ func MessageAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Get user from context (set by AuthMiddleware)
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
 	// Parse multipart form with a max memory of 50 MB
 	if err := r.ParseMultipartForm(50 << 20); err != nil {
 		http.Error(w, "Error parsing form data", http.StatusBadRequest)
@@ -221,33 +344,24 @@ func MessageAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Validate file type
-	if !isValidFileType(header.Filename) {
-		http.Error(w, "Invalid file type. Only images and videos are allowed.", http.StatusBadRequest)
+	// Validate the file's contents against its type
+	contentType, err := detectUploadType(file, header.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Generate unique filename
 	filename := generateUniqueFilename(header.Filename)
 
-	// Ensure uploads directory exists
-	uploadDir := utils.GetUploadsDir() + "/messages"
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		http.Error(w, "Unable to create upload directory", http.StatusInternalServerError)
-		return
-	}
-
-	// Create destination file
-	dstPath := filepath.Join(uploadDir, filename)
-	dst, err := os.Create(dstPath)
+	// Store the file and record it as the user's upload
+	url, err := saveUpload(r.Context(), user.ID, file, "messages", filename, contentType)
 	if err != nil {
-		http.Error(w, "Unable to save file", http.StatusInternalServerError)
-		return
-	}
-	defer dst.Close()
-
-	// Copy file data
-	if _, err := io.Copy(dst, file); err != nil {
+		if errors.Is(err, errFileTypeMismatch) {
+			http.Error(w, errFileTypeMismatch.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error saving attachment for user %d: %v", user.ID, err)
 		http.Error(w, "Error saving file", http.StatusInternalServerError)
 		return
 	}
@@ -255,9 +369,9 @@ func MessageAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	// Build response with file URL
 	resp := UploadResponse{
 		Filename: filename,
-		URL:      "/uploads/messages/" + filename,
+		URL:      url,
 	}
-	
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
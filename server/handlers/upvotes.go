@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project/server/database"
+	"project/server/models"
+
+	"github.com/gorilla/mux"
+)
+
+// UpvoteContentHandler records an upvote from the authenticated user on a content item
+func UpvoteContentHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	contentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Check if content exists; content not yet approved is only visible to its author
+	var contentExists bool
+	err = database.DBPool.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM content WHERE id = $1 AND (moderation_status = 'approved' OR user_id = $2))
+	`, contentID, user.ID).Scan(&contentExists)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !contentExists {
+		http.Error(w, "Content not found", http.StatusNotFound)
+		return
+	}
+
+	// Insert upvote (voting twice is a no-op)
+	_, err = database.DBPool.Exec(ctx, `
+		INSERT INTO upvotes (user_id, content_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, content_id) DO NOTHING
+	`, user.ID, contentID)
+	if err != nil {
+		log.Printf("Error upvoting content %d: %v", contentID, err)
+		http.Error(w, "Error upvoting content", http.StatusInternalServerError)
+		return
+	}
+
+	writeUpvoteState(ctx, w, contentID, user.ID)
+}
+
+// RemoveUpvoteHandler removes the authenticated user's upvote from a content item
+func RemoveUpvoteHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	contentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Check if content exists; content not yet approved is only visible to its author
+	var contentExists bool
+	err = database.DBPool.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM content WHERE id = $1 AND (moderation_status = 'approved' OR user_id = $2))
+	`, contentID, user.ID).Scan(&contentExists)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !contentExists {
+		http.Error(w, "Content not found", http.StatusNotFound)
+		return
+	}
+
+	// Delete upvote (removing a missing vote is a no-op)
+	_, err = database.DBPool.Exec(ctx, `
+		DELETE FROM upvotes WHERE user_id = $1 AND content_id = $2
+	`, user.ID, contentID)
+	if err != nil {
+		log.Printf("Error removing upvote on content %d: %v", contentID, err)
+		http.Error(w, "Error removing upvote", http.StatusInternalServerError)
+		return
+	}
+
+	writeUpvoteState(ctx, w, contentID, user.ID)
+}
+
+// writeUpvoteState responds with the current upvote count and the user's vote on a content item
+func writeUpvoteState(ctx context.Context, w http.ResponseWriter, contentID, userID int) {
+	resp := models.UpvoteResponse{ContentID: contentID}
+	err := database.DBPool.QueryRow(ctx, `
+		SELECT upvote_count,
+		       EXISTS(SELECT 1 FROM upvotes WHERE content_id = $1 AND user_id = $2)
+		FROM content WHERE id = $1 AND (moderation_status = 'approved' OR user_id = $2)
+	`, contentID, userID).Scan(&resp.Upvotes, &resp.HasUpvoted)
+	if err != nil {
+		http.Error(w, "Error fetching upvotes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
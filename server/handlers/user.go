@@ -7,10 +7,13 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"project/server/database"
+	"project/server/middleware"
 	"project/server/models"
+	"project/server/utils"
 
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5"
@@ -53,7 +56,9 @@ func GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(profile)
 }
 
-// UpdateUserProfileHandler updates the authenticated user's profile
+// UpdateUserProfileHandler updates the authenticated user's profile. Email
+// and password changes must be confirmed with the current password and, when
+// enabled, a two-factor code; a new password signs out every other session.
 func UpdateUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user from context (set by AuthMiddleware)
 	user, ok := r.Context().Value(models.UserContextKey).(models.User)
@@ -69,10 +74,79 @@ func UpdateUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Email != "" {
+		email, ok := normalizeEmail(req.Email)
+		if !ok {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+		req.Email = email
+	}
+
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	tx, err := database.DBPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	emailChanged := req.Email != "" && !strings.EqualFold(req.Email, user.Email)
+	if emailChanged || req.Password != "" {
+		// A stolen access token alone must not be enough to take the account over
+		var passwordHash, email string
+		var twoFactorEnabled bool
+		err := tx.QueryRow(ctx, `
+			SELECT password_hash, email, totp_enabled_at IS NOT NULL FROM users
+			WHERE id = $1
+			FOR UPDATE
+		`, user.ID).Scan(&passwordHash, &email, &twoFactorEnabled)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		clientIP := utils.ClientIP(r)
+		retryAfter, err := loginRetryAfter(ctx, email, clientIP)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if retryAfter > 0 {
+			writeTooManyLoginAttempts(w, retryAfter)
+			return
+		}
+
+		// Accounts created through an identity provider have no password yet
+		if passwordHash != "" && bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.CurrentPassword)) != nil {
+			tx.Rollback(ctx)
+			recordLoginFailure(ctx, email, clientIP, &user.ID)
+			http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+			return
+		}
+
+		if twoFactorEnabled {
+			if req.Code == "" {
+				http.Error(w, "Authentication code is required", http.StatusBadRequest)
+				return
+			}
+			valid, err := verifySecondFactor(ctx, tx, user.ID, req.Code)
+			if err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if !valid {
+				tx.Rollback(ctx)
+				recordLoginFailure(ctx, email, clientIP, &user.ID)
+				http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
 	// Start building the query
 	query := "UPDATE users SET updated_at = NOW()"
 	args := []interface{}{}
@@ -102,11 +176,11 @@ func UpdateUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 		argPosition++
 	}
 
-	if req.Email != "" {
+	if emailChanged {
 		// Check if email is already taken
 		var count int
 		err := database.DBPool.QueryRow(ctx,
-			"SELECT COUNT(*) FROM users WHERE email = $1 AND id != $2",
+			"SELECT COUNT(*) FROM users WHERE LOWER(email) = $1 AND id != $2",
 			req.Email, user.ID,
 		).Scan(&count)
 
@@ -120,7 +194,8 @@ func UpdateUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		query += ", email = $" + strconv.Itoa(argPosition)
+		// A new address has to be verified again
+		query += ", verified_at = NULL, verification_sent_at = NOW(), email = $" + strconv.Itoa(argPosition)
 		args = append(args, req.Email)
 		argPosition++
 	}
@@ -144,19 +219,41 @@ func UpdateUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Execute the update if there are fields to update
 	if len(args) > 1 { // More than just the user ID
-		_, err := database.DBPool.Exec(ctx, query, args...)
+		_, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			http.Error(w, "Error updating profile", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Whoever knew the old password is signed out everywhere but here
+	var revokedSessions []int
+	if req.Password != "" {
+		currentSessionID, _ := r.Context().Value(models.SessionContextKey).(int)
+		revokedSessions, err = revokeUserSessions(ctx, tx, user.ID, currentSessionID)
 		if err != nil {
 			http.Error(w, "Error updating profile", http.StatusInternalServerError)
 			return
 		}
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Error updating profile", http.StatusInternalServerError)
+		return
+	}
+	for _, sessionID := range revokedSessions {
+		middleware.SetSessionRevoked(sessionID)
+	}
+
 	// Update local user object with new values
 	if req.Username != "" {
 		user.Username = req.Username
 	}
-	if req.Email != "" {
+	if emailChanged {
 		user.Email = req.Email
+		if err := sendVerificationEmail(user.ID, user.Username, user.Email); err != nil {
+			log.Printf("Error creating verification link for user %d: %v", user.ID, err)
+		}
 	}
 
 	// Return updated user
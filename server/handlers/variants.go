@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/server/database"
+	"project/server/imaging"
+	"project/server/models"
+	"project/server/storage"
+
+	"github.com/jackc/pgx/v5"
+	_ "golang.org/x/image/webp"
+)
+
+// imageVariantWidths are the widths resized copies of uploaded images are
+// generated at. Only widths smaller than the original are produced. Copies
+// are JPEG: WebP sources can be decoded, but there is no pure Go encoder.
+var imageVariantWidths = []int{320, 640, 1280}
+
+const (
+	// imageVariantQuality is the JPEG quality of resized copies
+	imageVariantQuality = 82
+	// imageVariantMaxBytes and imageVariantMaxPixels keep huge images from
+	// exhausting memory when decoded
+	imageVariantMaxBytes  = 100 << 20
+	imageVariantMaxPixels = 50_000_000
+	// imageVariantCheckInterval is how often the variant worker looks for
+	// images it was not told about, such as uploads made by other instances
+	imageVariantCheckInterval = time.Minute
+	// thumbnailWidth is the widest variant used as a content thumbnail
+	thumbnailWidth = 640
+	// imageVariantRetryDelay is how long the worker waits before retrying an
+	// upload whose variants failed; it doubles with each attempt
+	imageVariantRetryDelay = time.Minute
+	// imageVariantMaxAttempts is how often an upload is tried before it is
+	// marked processed without variants
+	imageVariantMaxAttempts = 5
+)
+
+// contentThumbnailSQL selects a content item's (aliased c) thumbnail: the
+// widest variant up to thumbnailWidth of its chosen thumbnail, or of its first
+// image when none was chosen, falling back to the thumbnail URL as sent
+var contentThumbnailSQL = `COALESCE((
+	SELECT v.url FROM image_variants v
+	JOIN uploads u ON u.id = v.upload_id
+	WHERE u.url = COALESCE(NULLIF(c.thumbnail_url, ''), (
+		SELECT ci.image_url FROM content_images ci
+		WHERE ci.content_id = c.id
+		ORDER BY ci.image_order, ci.id
+		LIMIT 1
+	)) AND v.width <= ` + strconv.Itoa(thumbnailWidth) + `
+	ORDER BY v.width DESC
+	LIMIT 1
+), c.thumbnail_url)`
+
+// imageVariantsQueued wakes the variant worker after an image is uploaded
+var imageVariantsQueued = make(chan struct{}, 1)
+
+// queueImageVariants asks the variant worker to look for new images
+func queueImageVariants() {
+	select {
+	case imageVariantsQueued <- struct{}{}:
+	default:
+	}
+}
+
+// RunImageVariants generates resized copies of uploaded images until ctx is
+// cancelled. It works through uploads without variants whenever an image is
+// uploaded and every imageVariantCheckInterval. Several instances can run it
+// at once; each upload is handled by only one of them.
+func RunImageVariants(ctx context.Context) {
+	ticker := time.NewTicker(imageVariantCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			processed, err := processNextImageVariants(ctx)
+			if err != nil {
+				log.Printf("Error generating image variants: %v", err)
+			}
+			if !processed {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-imageVariantsQueued:
+		}
+	}
+}
+
+// processNextImageVariants generates the variants of one upload that has not
+// been processed yet and reports whether there was one. Images that cannot
+// be decoded are marked processed without variants so they are not retried;
+// other failures are retried later, so one upload cannot hold up the rest.
+func processNextImageVariants(ctx context.Context) (bool, error) {
+	jobCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	tx, err := database.DBPool.Begin(jobCtx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(jobCtx)
+
+	// Skip rows another instance is already processing
+	var uploadID int
+	var url, mimeType string
+	err = tx.QueryRow(jobCtx, `
+		SELECT id, url, mime_type FROM uploads
+		WHERE variants_processed_at IS NULL AND (variants_retry_at IS NULL OR variants_retry_at <= NOW())
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`).Scan(&uploadID, &url, &mimeType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := storeImageVariants(jobCtx, tx, uploadID, url, mimeType); err != nil {
+		tx.Rollback(jobCtx)
+		return recordImageVariantsFailure(ctx, uploadID, err)
+	}
+	return true, nil
+}
+
+// storeImageVariants generates and records the variants of an upload locked
+// by tx and marks it processed
+func storeImageVariants(ctx context.Context, tx pgx.Tx, uploadID int, url, mimeType string) error {
+	var variants []storedVariant
+	if key, ok := storage.KeyFromURL(url); ok && isResizableImage(mimeType) {
+		var err error
+		variants, err = generateImageVariants(ctx, key)
+		if err != nil {
+			if !errors.Is(err, errUndecodableImage) {
+				return err
+			}
+			log.Printf("Skipping image variants for upload %d: %v", uploadID, err)
+		}
+	}
+
+	for _, v := range variants {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO image_variants (upload_id, width, height, url, size_bytes, mime_type)
+			VALUES ($1, $2, $3, $4, $5, 'image/jpeg')
+			ON CONFLICT (upload_id, width) DO UPDATE
+			SET height = EXCLUDED.height, url = EXCLUDED.url, size_bytes = EXCLUDED.size_bytes
+		`, uploadID, v.Width, v.Height, v.URL, v.size)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE uploads SET variants_processed_at = NOW() WHERE id = $1`, uploadID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// recordImageVariantsFailure schedules a retry of an upload's variants with
+// exponential backoff, or gives up on it after imageVariantMaxAttempts. It
+// reports whether the failure was recorded, so the worker can move on.
+func recordImageVariantsFailure(ctx context.Context, uploadID int, cause error) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var attempts int
+	err := database.DBPool.QueryRow(ctx, `
+		UPDATE uploads SET
+			variants_attempts = variants_attempts + 1,
+			variants_retry_at = NOW() + $2::interval * POWER(2, LEAST(variants_attempts, 10)),
+			variants_processed_at = CASE WHEN variants_attempts + 1 >= $3 THEN NOW() END
+		WHERE id = $1
+		RETURNING variants_attempts
+	`, uploadID, intervalString(imageVariantRetryDelay), imageVariantMaxAttempts).Scan(&attempts)
+	if err != nil {
+		return false, fmt.Errorf("upload %d: %v (recording the failure: %v)", uploadID, cause, err)
+	}
+	if attempts >= imageVariantMaxAttempts {
+		return true, fmt.Errorf("upload %d: %v (giving up after %d attempts)", uploadID, cause, attempts)
+	}
+	return true, fmt.Errorf("upload %d: %v (attempt %d, will retry)", uploadID, cause, attempts)
+}
+
+// storedVariant is a variant written to storage but not yet recorded
+type storedVariant struct {
+	models.ImageVariant
+	size int64
+}
+
+// errUndecodableImage marks images the variant worker cannot read
+var errUndecodableImage = errors.New("undecodable image")
+
+// isResizableImage reports whether images of a content type can be decoded:
+// the standard library's formats, and WebP through golang.org/x/image
+func isResizableImage(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// generateImageVariants decodes the stored image at key and stores a JPEG copy
+// at each of imageVariantWidths narrower than the original, next to it under
+// "variants/"
+func generateImageVariants(ctx context.Context, key string) ([]storedVariant, error) {
+	src, _, err := storage.Default.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s is missing", errUndecodableImage, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Anything cut off by the limit fails to decode below
+	data, err := io.ReadAll(io.LimitReader(src, imageVariantMaxBytes))
+	src.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUndecodableImage, err)
+	}
+	if config.Width*config.Height > imageVariantMaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is too large", errUndecodableImage, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUndecodableImage, err)
+	}
+
+	// Copies carry no EXIF, so the orientation is applied to their pixels
+	flat := imaging.Orient(imaging.Flatten(img), imaging.Orientation(data))
+	base := "variants/" + strings.TrimSuffix(key, path.Ext(key))
+
+	var variants []storedVariant
+	for _, width := range imageVariantWidths {
+		if width >= flat.Bounds().Dx() {
+			break
+		}
+		height := imaging.FitWidth(flat.Bounds(), width)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, imaging.Resize(flat, width, height), &jpeg.Options{Quality: imageVariantQuality}); err != nil {
+			return nil, err
+		}
+		variantKey := fmt.Sprintf("%s_%dw.jpg", base, width)
+		size := int64(buf.Len())
+		if err := storage.Default.Put(ctx, variantKey, &buf, size, "image/jpeg"); err != nil {
+			return nil, err
+		}
+		variants = append(variants, storedVariant{
+			ImageVariant: models.ImageVariant{URL: storage.Default.URL(variantKey), Width: width, Height: height},
+			size:         size,
+		})
+	}
+	return variants, nil
+}
+
+// attachImageVariants fills in the variants and srcset of images. Variants are
+// an optimisation, so on error the images are left as they are.
+func attachImageVariants(ctx context.Context, images []models.Image) {
+	if len(images) == 0 {
+		return
+	}
+	urls := make([]string, len(images))
+	for i, img := range images {
+		urls[i] = img.ImageURL
+	}
+
+	rows, err := database.DBPool.Query(ctx, `
+		SELECT u.url, v.url, v.width, v.height
+		FROM image_variants v
+		JOIN uploads u ON u.id = v.upload_id
+		WHERE u.url = ANY($1)
+		ORDER BY v.width
+	`, urls)
+	if err != nil {
+		log.Printf("Error loading image variants: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	variants := map[string][]models.ImageVariant{}
+	for rows.Next() {
+		var source string
+		var v models.ImageVariant
+		if err := rows.Scan(&source, &v.URL, &v.Width, &v.Height); err != nil {
+			log.Printf("Error loading image variants: %v", err)
+			return
+		}
+		variants[source] = append(variants[source], v)
+	}
+	if rows.Err() != nil {
+		log.Printf("Error loading image variants: %v", rows.Err())
+		return
+	}
+
+	for i := range images {
+		images[i].Variants = variants[images[i].ImageURL]
+		srcset := make([]string, len(images[i].Variants))
+		for j, v := range images[i].Variants {
+			srcset[j] = fmt.Sprintf("%s %dw", v.URL, v.Width)
+		}
+		images[i].SrcSet = strings.Join(srcset, ", ")
+	}
+}
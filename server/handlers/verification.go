@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"project/server/database"
+	"project/server/mail"
+	"project/server/models"
+	"project/server/utils"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// emailVerificationPurpose scopes signed verification links
+	emailVerificationPurpose = "verify-email"
+	// emailVerificationTTL is how long a verification link stays valid
+	emailVerificationTTL = 48 * time.Hour
+	// verificationResendInterval is the minimum time between verification emails to one account
+	verificationResendInterval = 2 * time.Minute
+)
+
+// emailVerificationClaims is the payload of a verification link. The link is
+// bound to the address, so it stops working if the email is changed.
+type emailVerificationClaims struct {
+	UserID int    `json:"u"`
+	Email  string `json:"e"`
+}
+
+// sendVerificationEmail emails a signed verification link to a user. The
+// message is sent in the background; failures are only logged.
+func sendVerificationEmail(userID int, username, email string) error {
+	token, err := utils.SignToken(emailVerificationPurpose, emailVerificationClaims{UserID: userID, Email: email}, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      email,
+		Subject: "Confirm your Arouzy email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link within 48 hours:\n\n%s\n\n"+
+			"If you did not create an account, you can ignore this email.\n",
+			username, utils.AppURL("/verify-email?token="+url.QueryEscape(token))),
+	}
+	go func() {
+		if err := mail.Send(msg); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", userID, err)
+		}
+	}()
+	return nil
+}
+
+// VerifyEmailHandler marks an account's email as verified using the token from a verification link
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	var claims emailVerificationClaims
+	if err := utils.VerifySignedToken(emailVerificationPurpose, req.Token, &claims); err != nil {
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var userID int
+	err := database.DBPool.QueryRow(ctx, `
+		UPDATE users SET verified_at = COALESCE(verified_at, NOW())
+		WHERE id = $1 AND email = $2
+		RETURNING id
+	`, claims.UserID, claims.Email).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// The account was deleted or its email changed since the link was sent
+			http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// ResendVerificationHandler sends the authenticated user a new verification
+// link, at most once per verificationResendInterval
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(models.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var email, username string
+	var verified bool
+	var sentAt *time.Time
+	err := database.DBPool.QueryRow(ctx, `
+		SELECT email, username, verified_at IS NOT NULL, verification_sent_at FROM users WHERE id = $1
+	`, user.ID).Scan(&email, &username, &verified, &sentAt)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if verified {
+		http.Error(w, "Email already verified", http.StatusBadRequest)
+		return
+	}
+
+	// Claim the send slot atomically so concurrent requests cannot both send
+	res, err := database.DBPool.Exec(ctx, `
+		UPDATE users SET verification_sent_at = NOW()
+		WHERE id = $1 AND (verification_sent_at IS NULL OR verification_sent_at <= NOW() - $2::interval)
+	`, user.ID, intervalString(verificationResendInterval))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		retryAfter := verificationResendInterval
+		if sentAt != nil {
+			retryAfter = time.Until(sentAt.Add(verificationResendInterval))
+		}
+		setRetryAfter(w, retryAfter)
+		http.Error(w, "Verification email sent recently, please wait before requesting another", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := sendVerificationEmail(user.ID, username, email); err != nil {
+		log.Printf("Error creating verification link for user %d: %v", user.ID, err)
+		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
@@ -0,0 +1,241 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// exifTag identifies an EXIF tag and the directory it lives in
+type exifTag struct {
+	exifIFD bool // in the Exif sub-directory rather than IFD0
+	id      uint16
+}
+
+const (
+	tagOrientation    = 0x0112
+	tagExifIFDPointer = 0x8769
+)
+
+// exifTags are the tags that may be kept when stripping metadata. Anything
+// else, notably GPS data, serial numbers, owner names and maker notes, is
+// always removed.
+var exifTags = map[string]exifTag{
+	"Orientation":      {false, tagOrientation},
+	"ImageWidth":       {false, 0x0100},
+	"ImageLength":      {false, 0x0101},
+	"Make":             {false, 0x010F},
+	"Model":            {false, 0x0110},
+	"XResolution":      {false, 0x011A},
+	"YResolution":      {false, 0x011B},
+	"ResolutionUnit":   {false, 0x0128},
+	"ExposureTime":     {true, 0x829A},
+	"FNumber":          {true, 0x829D},
+	"ISOSpeedRatings":  {true, 0x8827},
+	"DateTimeOriginal": {true, 0x9003},
+	"FocalLength":      {true, 0x920A},
+	"ColorSpace":       {true, 0xA001},
+	"PixelXDimension":  {true, 0xA002},
+	"PixelYDimension":  {true, 0xA003},
+}
+
+// keptTags are the EXIF tags StripMetadata keeps. The orientation is always
+// kept so photos are still displayed the right way up.
+var keptTags = map[exifTag]bool{exifTags["Orientation"]: true}
+
+// Init reads EXIF_KEEP_TAGS, a comma-separated list of tag names from
+// exifTags (e.g. "PixelXDimension,PixelYDimension") to keep in uploaded
+// photos in addition to the orientation.
+func Init() error {
+	for _, name := range strings.Split(os.Getenv("EXIF_KEEP_TAGS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		tag, ok := exifTags[name]
+		if !ok {
+			return fmt.Errorf("unknown EXIF tag %q in EXIF_KEEP_TAGS", name)
+		}
+		keptTags[tag] = true
+	}
+	return nil
+}
+
+// tiffEntry is one directory entry; value holds its raw bytes in the file's
+// byte order
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// tiffTypeSizes are the sizes in bytes of the TIFF field types
+var tiffTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+var errBadEXIF = errors.New("malformed EXIF data")
+
+// parseTIFF reads the byte order and the IFD0 and Exif directory entries of
+// EXIF data (the TIFF structure after the "Exif\0\0" marker)
+func parseTIFF(tiff []byte) (binary.ByteOrder, []tiffEntry, []tiffEntry, error) {
+	if len(tiff) < 8 {
+		return nil, nil, nil, errBadEXIF
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, nil, nil, errBadEXIF
+	}
+
+	ifd0, err := readIFD(tiff, order, order.Uint32(tiff[4:8]))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var exif []tiffEntry
+	for _, e := range ifd0 {
+		if e.tag == tagExifIFDPointer && e.typ == 4 && e.count == 1 {
+			if exif, err = readIFD(tiff, order, order.Uint32(e.value)); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	return order, ifd0, exif, nil
+}
+
+// readIFD reads the entries of the directory at offset. Entries of unknown
+// types are skipped.
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) ([]tiffEntry, error) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return nil, errBadEXIF
+	}
+	n := uint64(order.Uint16(tiff[offset:]))
+	start := uint64(offset) + 2
+	if start+n*12 > uint64(len(tiff)) {
+		return nil, errBadEXIF
+	}
+
+	var entries []tiffEntry
+	for i := uint64(0); i < n; i++ {
+		raw := tiff[start+i*12 : start+i*12+12]
+		e := tiffEntry{tag: order.Uint16(raw[0:2]), typ: order.Uint16(raw[2:4]), count: order.Uint32(raw[4:8])}
+		typeSize, ok := tiffTypeSizes[e.typ]
+		if !ok {
+			continue
+		}
+		size := uint64(typeSize) * uint64(e.count)
+		if size <= 4 {
+			e.value = raw[8 : 8+size]
+		} else {
+			valueOffset := uint64(order.Uint32(raw[8:12]))
+			if valueOffset+size > uint64(len(tiff)) {
+				continue
+			}
+			e.value = tiff[valueOffset : valueOffset+size]
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// keptEXIF returns a new EXIF block containing only the kept tags of tiff,
+// or nil when none of them are present
+func keptEXIF(tiff []byte) []byte {
+	order, ifd0, exif, err := parseTIFF(tiff)
+	if err != nil {
+		return nil
+	}
+	var keptIFD0, keptExif []tiffEntry
+	for _, e := range ifd0 {
+		if keptTags[exifTag{false, e.tag}] {
+			keptIFD0 = append(keptIFD0, e)
+		}
+	}
+	for _, e := range exif {
+		if keptTags[exifTag{true, e.tag}] {
+			keptExif = append(keptExif, e)
+		}
+	}
+	if len(keptIFD0) == 0 && len(keptExif) == 0 {
+		return nil
+	}
+	return buildTIFF(order, keptIFD0, keptExif)
+}
+
+// buildTIFF lays out IFD0, the Exif directory (if it has entries) and the
+// values too large to store inline, in that order
+func buildTIFF(order binary.ByteOrder, ifd0, exif []tiffEntry) []byte {
+	if len(exif) > 0 {
+		// The pointer's value is filled in below once the layout is known
+		ifd0 = append(ifd0, tiffEntry{tag: tagExifIFDPointer, typ: 4, count: 1, value: make([]byte, 4)})
+	}
+	sort.Slice(ifd0, func(i, j int) bool { return ifd0[i].tag < ifd0[j].tag })
+	sort.Slice(exif, func(i, j int) bool { return exif[i].tag < exif[j].tag })
+
+	ifdSize := func(entries []tiffEntry) int { return 2 + 12*len(entries) + 4 }
+	exifOffset := 8 + ifdSize(ifd0)
+	dataOffset := exifOffset
+	if len(exif) > 0 {
+		dataOffset += ifdSize(exif)
+	}
+
+	out := make([]byte, dataOffset)
+	if order == binary.LittleEndian {
+		copy(out, "II")
+	} else {
+		copy(out, "MM")
+	}
+	order.PutUint16(out[2:], 42)
+	order.PutUint32(out[4:], 8)
+
+	writeIFD := func(offset int, entries []tiffEntry) {
+		order.PutUint16(out[offset:], uint16(len(entries)))
+		for i, e := range entries {
+			raw := out[offset+2+i*12:]
+			order.PutUint16(raw[0:], e.tag)
+			order.PutUint16(raw[2:], e.typ)
+			order.PutUint32(raw[4:], e.count)
+			if e.tag == tagExifIFDPointer && len(exif) > 0 {
+				order.PutUint32(raw[8:], uint32(exifOffset))
+			} else if len(e.value) <= 4 {
+				copy(raw[8:12], e.value)
+			} else {
+				order.PutUint32(raw[8:], uint32(len(out)))
+				out = append(out, e.value...)
+				if len(out)%2 == 1 {
+					out = append(out, 0)
+				}
+			}
+		}
+		// The next-directory offset stays zero
+	}
+	writeIFD(8, ifd0)
+	if len(exif) > 0 {
+		writeIFD(exifOffset, exif)
+	}
+	return out
+}
+
+// exifOrientation returns the orientation tag (1-8) of EXIF data, or 1
+func exifOrientation(tiff []byte) int {
+	order, ifd0, _, err := parseTIFF(tiff)
+	if err != nil {
+		return 1
+	}
+	for _, e := range ifd0 {
+		if e.tag == tagOrientation && e.typ == 3 && e.count == 1 {
+			if o := int(order.Uint16(e.value)); o >= 1 && o <= 8 {
+				return o
+			}
+		}
+	}
+	return 1
+}
@@ -0,0 +1,222 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+	jfifHeader = []byte("JFIF\x00")
+	pngHeader  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// ErrMalformedImage is returned when an image's structure cannot be parsed
+var ErrMalformedImage = errors.New("malformed image")
+
+// StripMetadata removes EXIF, XMP, IPTC and comment metadata from a JPEG, PNG
+// or WebP image without re-encoding it. JPEG files keep a minimal EXIF block
+// with the orientation and any tags enabled through EXIF_KEEP_TAGS. Other
+// content types are returned unchanged.
+func StripMetadata(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+// Orientation returns the EXIF orientation (1-8) of a JPEG image, or 1 when
+// it has none
+func Orientation(data []byte) int {
+	orientation := 1
+	walkJPEG(data, func(marker byte, payload, scan []byte) {
+		if marker == 0xE1 && bytes.HasPrefix(payload, exifHeader) {
+			orientation = exifOrientation(payload[len(exifHeader):])
+		}
+	})
+	return orientation
+}
+
+// stripJPEG keeps the segments needed to decode and display the image (JFIF,
+// ICC colour profile, Adobe colour transform, tables, frame and scan data) and
+// replaces the EXIF segment with one holding only the kept tags. The same rules
+// apply to segments between the scans of progressive images. Trailers some
+// cameras append after the end-of-image marker (extra images, vendor data) are
+// dropped.
+func stripJPEG(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	err := walkJPEG(data, func(marker byte, payload, scan []byte) {
+		keep := false
+		switch {
+		case marker == 0xE0:
+			keep = bytes.HasPrefix(payload, jfifHeader)
+		case marker == 0xE1:
+			if bytes.HasPrefix(payload, exifHeader) {
+				if tiff := keptEXIF(payload[len(exifHeader):]); tiff != nil {
+					out = appendJPEGSegment(out, 0xE1, append(append([]byte{}, exifHeader...), tiff...))
+				}
+			}
+		case marker == 0xE2:
+			keep = bytes.HasPrefix(payload, iccHeader)
+		case marker == 0xEE:
+			keep = true // Adobe: needed to decode CMYK images
+		case marker >= 0xE3 && marker <= 0xEF, marker == 0xFE:
+			// Other application segments (IPTC, Photoshop, maker data) and comments
+		default:
+			keep = true
+		}
+		if keep {
+			out = appendJPEGSegment(out, marker, payload)
+			out = append(out, scan...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(out, 0xFF, 0xD9), nil
+}
+
+// walkJPEG calls fn for each marker segment up to the end-of-image marker. For
+// start-of-scan segments scan holds the entropy-coded data that follows them,
+// restart markers included. A file that ends inside scan data is accepted as if
+// it ended there.
+func walkJPEG(data []byte, fn func(marker byte, payload, scan []byte)) error {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return ErrMalformedImage
+	}
+	i := 2
+	for {
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return ErrMalformedImage
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before a marker
+			i++
+			continue
+		case marker == 0xD9:
+			return nil
+		case marker == 0x01, marker >= 0xD0 && marker <= 0xD7:
+			// Markers without a payload
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return ErrMalformedImage
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return ErrMalformedImage
+		}
+		payload := data[i+4 : i+2+length]
+		i += 2 + length
+
+		var scan []byte
+		if marker == 0xDA {
+			end := jpegScanEnd(data, i)
+			scan, i = data[i:end], end
+		}
+		fn(marker, payload, scan)
+		if marker == 0xDA && i == len(data) {
+			return nil
+		}
+	}
+}
+
+// jpegScanEnd returns the offset of the first marker at or after start, or
+// len(data) when there is none. Entropy-coded data escapes 0xFF bytes as
+// FF 00 and contains restart markers (FF D0 to FF D7); any other FF xx pair
+// starts the next segment.
+func jpegScanEnd(data []byte, start int) int {
+	for i := start; i+1 < len(data); i++ {
+		if data[i] != 0xFF {
+			continue
+		}
+		if next := data[i+1]; next != 0x00 && next != 0xFF && (next < 0xD0 || next > 0xD7) {
+			return i
+		}
+	}
+	return len(data)
+}
+
+// appendJPEGSegment appends a marker segment with its length
+func appendJPEGSegment(out []byte, marker byte, payload []byte) []byte {
+	out = append(out, 0xFF, marker)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+	return append(out, payload...)
+}
+
+// stripPNG drops the eXIf, text (which carries XMP) and timestamp chunks.
+// Chunk checksums cover only their own chunk, so the rest is copied as is.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngHeader) {
+		return nil, ErrMalformedImage
+	}
+	out := append(make([]byte, 0, len(data)), pngHeader...)
+	for i := len(pngHeader); i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrMalformedImage
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkEnd := i + 12 + length
+		if length < 0 || chunkEnd > len(data) {
+			return nil, ErrMalformedImage
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out = append(out, data[i:chunkEnd]...)
+		}
+		if string(data[i+4:i+8]) == "IEND" {
+			break
+		}
+		i = chunkEnd
+	}
+	return out, nil
+}
+
+// stripWebP drops the EXIF and XMP chunks of an extended WebP file and clears
+// their flags in its header
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformedImage
+	}
+	out := append(make([]byte, 0, len(data)), data[:12]...)
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrMalformedImage
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		chunkEnd := i + 8 + size + size%2
+		if size < 0 || i+8+size > len(data) {
+			return nil, ErrMalformedImage
+		}
+		if chunkEnd > len(data) {
+			chunkEnd = len(data)
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, data[i:chunkEnd]...)
+			if size > 0 {
+				// Flags: 0x08 EXIF present, 0x04 XMP present
+				out[start+8] &^= 0x08 | 0x04
+			}
+		default:
+			out = append(out, data[i:chunkEnd]...)
+		}
+		i = chunkEnd
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,401 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+const (
+	tagMake             = 0x010F
+	tagGPSIFDPointer    = 0x8825
+	tagDateTimeOriginal = 0x9003
+)
+
+// testEXIF builds EXIF data (without the "Exif\0\0" marker) with an
+// orientation, a camera make, a GPS pointer and an original date
+func testEXIF(order binary.ByteOrder, orientation uint16) []byte {
+	short := make([]byte, 2)
+	order.PutUint16(short, orientation)
+	ifd0 := []tiffEntry{
+		{tag: tagOrientation, typ: 3, count: 1, value: short},
+		{tag: tagMake, typ: 2, count: 6, value: []byte("Canon\x00")},
+		{tag: tagGPSIFDPointer, typ: 4, count: 1, value: make([]byte, 4)},
+	}
+	exif := []tiffEntry{
+		{tag: tagDateTimeOriginal, typ: 2, count: 20, value: []byte("2024:01:02 03:04:05\x00")},
+	}
+	return buildTIFF(order, ifd0, exif)
+}
+
+// tagsOf lists the IFD0 and Exif directory tags of EXIF data
+func tagsOf(t *testing.T, tiff []byte) (ifd0Tags, exifTags []uint16) {
+	t.Helper()
+	_, ifd0, exif, err := parseTIFF(tiff)
+	if err != nil {
+		t.Fatalf("parseTIFF: %v", err)
+	}
+	for _, e := range ifd0 {
+		ifd0Tags = append(ifd0Tags, e.tag)
+	}
+	for _, e := range exif {
+		exifTags = append(exifTags, e.tag)
+	}
+	return ifd0Tags, exifTags
+}
+
+func equalTags(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestKeptEXIF(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			kept := keptEXIF(testEXIF(order, 6))
+			if kept == nil {
+				t.Fatal("keptEXIF() = nil, want the orientation")
+			}
+			ifd0, exif := tagsOf(t, kept)
+			if !equalTags(ifd0, []uint16{tagOrientation}) || len(exif) != 0 {
+				t.Errorf("kept tags = %x, %x, want only the orientation", ifd0, exif)
+			}
+			if got := exifOrientation(kept); got != 6 {
+				t.Errorf("orientation = %d, want 6", got)
+			}
+		})
+	}
+}
+
+func TestKeptEXIFExtraTags(t *testing.T) {
+	keptTags[exifTags["Make"]] = true
+	keptTags[exifTags["DateTimeOriginal"]] = true
+	defer func() {
+		delete(keptTags, exifTags["Make"])
+		delete(keptTags, exifTags["DateTimeOriginal"])
+	}()
+
+	kept := keptEXIF(testEXIF(binary.BigEndian, 3))
+	ifd0, exif := tagsOf(t, kept)
+	if !equalTags(ifd0, []uint16{tagMake, tagOrientation, tagExifIFDPointer}) {
+		t.Errorf("IFD0 tags = %x, want make, orientation and the Exif pointer", ifd0)
+	}
+	if !equalTags(exif, []uint16{tagDateTimeOriginal}) {
+		t.Errorf("Exif tags = %x, want the original date", exif)
+	}
+
+	_, entries, _, _ := parseTIFF(kept)
+	for _, e := range entries {
+		if e.tag == tagMake && string(e.value) != "Canon\x00" {
+			t.Errorf("make = %q, want %q", e.value, "Canon\x00")
+		}
+	}
+}
+
+func TestKeptEXIFWithoutKeptTags(t *testing.T) {
+	tiff := buildTIFF(binary.LittleEndian, []tiffEntry{
+		{tag: tagGPSIFDPointer, typ: 4, count: 1, value: make([]byte, 4)},
+	}, nil)
+	if kept := keptEXIF(tiff); kept != nil {
+		t.Errorf("keptEXIF() = %x, want nil", kept)
+	}
+	if kept := keptEXIF([]byte("not exif")); kept != nil {
+		t.Errorf("keptEXIF(garbage) = %x, want nil", kept)
+	}
+}
+
+// testJPEG encodes a small JPEG and inserts segments after its start marker
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	out := append([]byte{}, encoded[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, encoded[2:]...)
+}
+
+func segment(marker byte, payload []byte) []byte {
+	return appendJPEGSegment(nil, marker, payload)
+}
+
+// markersOf lists the markers of a JPEG's segments
+func markersOf(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var markers []byte
+	if err := walkJPEG(data, func(marker byte, payload, scan []byte) {
+		markers = append(markers, marker)
+	}); err != nil {
+		t.Fatalf("walkJPEG: %v", err)
+	}
+	return markers
+}
+
+func TestStripJPEG(t *testing.T) {
+	exif := append(append([]byte{}, exifHeader...), testEXIF(binary.LittleEndian, 8)...)
+	data := testJPEG(t,
+		segment(0xE0, append(append([]byte{}, jfifHeader...), 1, 1, 0, 0, 1, 0, 1, 0, 0)),
+		segment(0xE1, exif),
+		segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")),
+		segment(0xE2, append(append([]byte{}, iccHeader...), 1, 1)),
+		segment(0xED, []byte("Photoshop 3.0\x00IPTC")),
+		segment(0xFE, []byte("a comment")),
+	)
+	data = append(data, []byte("trailing vendor data")...)
+
+	out, err := stripJPEG(data)
+	if err != nil {
+		t.Fatalf("stripJPEG: %v", err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("stripped image does not decode: %v", err)
+	}
+	if !bytes.HasSuffix(out, []byte{0xFF, 0xD9}) {
+		t.Error("trailer after the end-of-image marker was kept")
+	}
+	for _, dropped := range []string{"xmpmeta", "IPTC", "a comment", "Canon"} {
+		if bytes.Contains(out, []byte(dropped)) {
+			t.Errorf("stripped image still contains %q", dropped)
+		}
+	}
+	if !bytes.Contains(out, jfifHeader) || !bytes.Contains(out, iccHeader) {
+		t.Error("JFIF or ICC segment was dropped")
+	}
+	if got := Orientation(out); got != 8 {
+		t.Errorf("Orientation() = %d, want 8", got)
+	}
+
+	var exifSegments int
+	walkJPEG(out, func(marker byte, payload, scan []byte) {
+		if marker == 0xE1 {
+			exifSegments++
+			ifd0, exif := tagsOf(t, payload[len(exifHeader):])
+			if !equalTags(ifd0, []uint16{tagOrientation}) || len(exif) != 0 {
+				t.Errorf("kept EXIF tags = %x, %x, want only the orientation", ifd0, exif)
+			}
+		}
+	})
+	if exifSegments != 1 {
+		t.Errorf("found %d EXIF segments, want 1", exifSegments)
+	}
+}
+
+func TestStripJPEGBetweenScans(t *testing.T) {
+	sos := segment(0xDA, []byte{1, 1, 0, 0, 63, 0})
+	// Entropy-coded data with an escaped 0xFF and a restart marker
+	scan1 := []byte{0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56}
+	scan2 := []byte{0x78, 0xFF, 0x00, 0x9A}
+
+	var data []byte
+	data = append(data, 0xFF, 0xD8)
+	data = append(data, segment(0xDB, make([]byte, 65))...)
+	data = append(data, sos...)
+	data = append(data, scan1...)
+	data = append(data, segment(0xFE, []byte("between scans"))...)
+	data = append(data, segment(0xC4, []byte{0, 1})...)
+	data = append(data, segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00"))...)
+	data = append(data, sos...)
+	data = append(data, scan2...)
+	data = append(data, 0xFF, 0xD9)
+	data = append(data, []byte("\xFF\xD8 second image")...)
+
+	out, err := stripJPEG(data)
+	if err != nil {
+		t.Fatalf("stripJPEG: %v", err)
+	}
+	var want []byte
+	want = append(want, 0xFF, 0xD8)
+	want = append(want, segment(0xDB, make([]byte, 65))...)
+	want = append(want, sos...)
+	want = append(want, scan1...)
+	want = append(want, segment(0xC4, []byte{0, 1})...)
+	want = append(want, sos...)
+	want = append(want, scan2...)
+	want = append(want, 0xFF, 0xD9)
+	if !bytes.Equal(out, want) {
+		t.Errorf("stripJPEG() =\n%x\nwant\n%x", out, want)
+	}
+	if got := markersOf(t, out); !bytes.Equal(got, []byte{0xDB, 0xDA, 0xC4, 0xDA}) {
+		t.Errorf("markers = %x, want db da c4 da", got)
+	}
+}
+
+func TestStripJPEGTruncatedScan(t *testing.T) {
+	data := []byte{0xFF, 0xD8}
+	data = append(data, segment(0xDA, []byte{1, 1, 0, 0, 63, 0})...)
+	data = append(data, 0x12, 0x34)
+
+	out, err := stripJPEG(data)
+	if err != nil {
+		t.Fatalf("stripJPEG: %v", err)
+	}
+	want := append(append([]byte{}, data...), 0xFF, 0xD9)
+	if !bytes.Equal(out, want) {
+		t.Errorf("stripJPEG() = %x, want %x", out, want)
+	}
+}
+
+func TestStripJPEGMalformed(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":          nil,
+		"not a jpeg":     []byte("GIF89a"),
+		"no marker":      {0xFF, 0xD8, 0x00, 0x00},
+		"short length":   {0xFF, 0xD8, 0xFF, 0xE0, 0x00},
+		"length too big": {0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x00},
+		"no scan":        append([]byte{0xFF, 0xD8}, segment(0xDB, []byte{0})...),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := stripJPEG(data); !errors.Is(err, ErrMalformedImage) {
+				t.Errorf("stripJPEG() error = %v, want ErrMalformedImage", err)
+			}
+		})
+	}
+}
+
+// pngChunk builds a PNG chunk with its checksum
+func pngChunk(typ string, data []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	out = append(out, typ...)
+	out = append(out, data...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[4:]))
+}
+
+func TestStripPNG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.NRGBA{R: 255, A: 128})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	// IHDR is the first chunk; metadata goes right after it
+	ihdrEnd := len(pngHeader) + 12 + int(binary.BigEndian.Uint32(encoded[len(pngHeader):]))
+
+	var data []byte
+	data = append(data, encoded[:ihdrEnd]...)
+	data = append(data, pngChunk("tEXt", []byte("Author\x00someone"))...)
+	data = append(data, pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))...)
+	data = append(data, pngChunk("eXIf", testEXIF(binary.BigEndian, 1))...)
+	data = append(data, pngChunk("tIME", []byte{0x07, 0xE8, 1, 2, 3, 4, 5})...)
+	data = append(data, pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F})...)
+	data = append(data, encoded[ihdrEnd:]...)
+	data = append(data, []byte("trailing data")...)
+
+	out, err := stripPNG(data)
+	if err != nil {
+		t.Fatalf("stripPNG: %v", err)
+	}
+	want := append(append(append([]byte{}, encoded[:ihdrEnd]...), pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F})...), encoded[ihdrEnd:]...)
+	if !bytes.Equal(out, want) {
+		t.Errorf("stripPNG() kept the wrong chunks")
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("stripped image does not decode: %v", err)
+	}
+
+	if _, err := stripPNG([]byte("not a png")); !errors.Is(err, ErrMalformedImage) {
+		t.Errorf("stripPNG(garbage) error = %v, want ErrMalformedImage", err)
+	}
+	if _, err := stripPNG(append(append([]byte{}, pngHeader...), 0, 0, 1, 0, 'I', 'D', 'A', 'T')); !errors.Is(err, ErrMalformedImage) {
+		t.Errorf("stripPNG(truncated) error = %v, want ErrMalformedImage", err)
+	}
+}
+
+// webpChunk builds a RIFF chunk, padded to an even size
+func webpChunk(fourCC string, data []byte) []byte {
+	out := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// webpFile wraps chunks in a RIFF WEBP header
+func webpFile(chunks ...[]byte) []byte {
+	var body []byte
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	out := []byte("RIFF")
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(body)+4))
+	out = append(out, "WEBP"...)
+	return append(out, body...)
+}
+
+func TestStripWebP(t *testing.T) {
+	// Flags: ICC (0x20), EXIF (0x08), XMP (0x04) and alpha (0x10)
+	vp8x := []byte{0x20 | 0x10 | 0x08 | 0x04, 0, 0, 0, 0x0F, 0, 0, 0x0F, 0, 0}
+	iccp := webpChunk("ICCP", []byte("icc"))
+	bitstream := webpChunk("VP8L", []byte{0x2F, 0x0F, 0xC0, 0x03, 0x00})
+	data := webpFile(
+		webpChunk("VP8X", vp8x),
+		iccp,
+		bitstream,
+		webpChunk("EXIF", testEXIF(binary.LittleEndian, 6)),
+		webpChunk("XMP ", []byte("<x:xmpmeta/>")),
+	)
+
+	out, err := stripWebP(data)
+	if err != nil {
+		t.Fatalf("stripWebP: %v", err)
+	}
+	strippedFlags := append([]byte{0x20 | 0x10}, vp8x[1:]...)
+	want := webpFile(webpChunk("VP8X", strippedFlags), iccp, bitstream)
+	if !bytes.Equal(out, want) {
+		t.Errorf("stripWebP() =\n%x\nwant\n%x", out, want)
+	}
+}
+
+func TestStripWebPSimple(t *testing.T) {
+	// Simple files have no metadata and pass through unchanged
+	data := webpFile(webpChunk("VP8 ", []byte{0x10, 0x02, 0x00, 0x9D, 0x01, 0x2A, 0x01, 0x00, 0x01, 0x00, 0x00}))
+	out, err := stripWebP(data)
+	if err != nil {
+		t.Fatalf("stripWebP: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("stripWebP() = %x, want %x", out, data)
+	}
+
+	for name, data := range map[string][]byte{
+		"not riff":     []byte("RIFX\x00\x00\x00\x00WEBP"),
+		"not webp":     []byte("RIFF\x00\x00\x00\x00AVI "),
+		"short chunk":  webpFile([]byte("VP8 \x01")),
+		"size too big": webpFile([]byte("VP8 \xFF\x00\x00\x00abc")),
+	} {
+		if _, err := stripWebP(data); !errors.Is(err, ErrMalformedImage) {
+			t.Errorf("stripWebP(%s) error = %v, want ErrMalformedImage", name, err)
+		}
+	}
+}
+
+func TestStripMetadataOtherTypes(t *testing.T) {
+	data := []byte("GIF89a...")
+	out, err := StripMetadata(data, "image/gif")
+	if err != nil || !bytes.Equal(out, data) {
+		t.Errorf("StripMetadata(gif) = %q, %v, want the data unchanged", out, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Package imaging prepares uploaded images: it strips their metadata and
+// resizes them using only the standard library's decoders and encoders.
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Flatten copies src into an RGBA image drawn over a white background, so
+// transparent areas stay white when encoded to JPEG
+func Flatten(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Over)
+	return dst
+}
+
+// FitWidth returns the height that keeps src's aspect ratio at width
+func FitWidth(src image.Rectangle, width int) int {
+	height := (src.Dy()*width + src.Dx()/2) / src.Dx()
+	if height < 1 {
+		height = 1
+	}
+	return height
+}
+
+// Resize scales src down to width x height by averaging the source pixels
+// each destination pixel covers (a box filter), which avoids the aliasing
+// of nearest-neighbour sampling. Sizes larger than src are not upscaled
+// well; callers only shrink.
+func Resize(src *image.RGBA, width, height int) *image.RGBA {
+	b := src.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+
+	// Horizontal pass: average columns into a width x srcH buffer of sums
+	xSpans := spans(srcW, width)
+	tmp := make([]uint32, width*srcH*4)
+	for y := 0; y < srcH; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+srcW*4]
+		for x, span := range xSpans {
+			var r, g, bl, a uint32
+			for sx := span[0]; sx < span[1]; sx++ {
+				p := row[sx*4 : sx*4+4]
+				r += uint32(p[0])
+				g += uint32(p[1])
+				bl += uint32(p[2])
+				a += uint32(p[3])
+			}
+			n := uint32(span[1] - span[0])
+			i := (y*width + x) * 4
+			tmp[i], tmp[i+1], tmp[i+2], tmp[i+3] = r/n, g/n, bl/n, a/n
+		}
+	}
+
+	// Vertical pass: average rows of the buffer into the destination
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, span := range spans(srcH, height) {
+		n := uint32(span[1] - span[0])
+		for x := 0; x < width; x++ {
+			var r, g, bl, a uint32
+			for sy := span[0]; sy < span[1]; sy++ {
+				i := (sy*width + x) * 4
+				r += tmp[i]
+				g += tmp[i+1]
+				bl += tmp[i+2]
+				a += tmp[i+3]
+			}
+			p := dst.Pix[y*dst.Stride+x*4:]
+			p[0], p[1], p[2], p[3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// spans splits [0, from) into to consecutive, non-empty ranges of source
+// indexes, one per destination index
+func spans(from, to int) [][2]int {
+	out := make([][2]int, to)
+	for i := range out {
+		start := i * from / to
+		end := (i + 1) * from / to
+		if end <= start {
+			end = start + 1
+		}
+		if end > from {
+			start, end = from-1, from
+		}
+		out[i] = [2]int{start, end}
+	}
+	return out
+}
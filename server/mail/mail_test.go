@@ -0,0 +1,151 @@
+package mail
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+)
+
+// smtpSession is what the test server received in one connection
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPServer accepts one SMTP connection on a local port, advertising
+// AUTH PLAIN but not STARTTLS, and reports what it received
+func startSMTPServer(t *testing.T) (string, <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var s smtpSession
+		reply("220 localhost test server")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"):
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case strings.HasPrefix(command, "AUTH PLAIN "):
+				decoded, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+				s.auth = string(decoded)
+				reply("235 Authenticated")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				s.from = line[len("MAIL FROM:"):]
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				s.to = append(s.to, line[len("RCPT TO:"):])
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 Go ahead")
+				var data strings.Builder
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				s.data = data.String()
+				reply("250 Queued")
+			case command == "QUIT":
+				reply("221 Bye")
+				sessions <- s
+				return
+			default:
+				reply("502 Unknown command")
+			}
+		}
+	}()
+	return listener.Addr().String(), sessions
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, sessions := startSMTPServer(t)
+	mailer := SMTPMailer{Addr: addr, Host: "localhost", From: "no-reply@arouzy.local"}
+
+	err := mailer.Send(Message{
+		To:      "jane@example.com\r\nBcc: victim@example.com",
+		Subject: "Reset your password\nBcc: victim@example.com",
+		Body:    "Hello\nUse this link",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	s := <-sessions
+	if s.auth != "" {
+		t.Errorf("authenticated without a username: %q", s.auth)
+	}
+	if s.from != "<no-reply@arouzy.local>" {
+		t.Errorf("MAIL FROM = %s, want <no-reply@arouzy.local>", s.from)
+	}
+	if len(s.to) != 1 || s.to[0] != "<jane@example.comBcc: victim@example.com>" {
+		t.Errorf("RCPT TO = %v, want the recipient on one line", s.to)
+	}
+	for _, want := range []string{
+		"From: no-reply@arouzy.local\r\n",
+		"Subject: Reset your passwordBcc: victim@example.com\r\n",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"\r\n\r\nHello\r\nUse this link",
+	} {
+		if !strings.Contains(s.data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, s.data)
+		}
+	}
+	if strings.Contains(s.data, "\r\nBcc:") {
+		t.Errorf("message has an injected header:\n%s", s.data)
+	}
+}
+
+func TestSMTPMailerAuth(t *testing.T) {
+	addr, sessions := startSMTPServer(t)
+	mailer := SMTPMailer{Addr: addr, Host: "127.0.0.1", Username: "user", Password: "secret", From: "no-reply@arouzy.local"}
+
+	if err := mailer.Send(Message{To: "jane@example.com", Subject: "Hi", Body: "Hello"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if s := <-sessions; s.auth != "\x00user\x00secret" {
+		t.Errorf("AUTH PLAIN = %q, want the username and password", s.auth)
+	}
+}
+
+func TestSMTPMailerUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	mailer := SMTPMailer{Addr: addr, Host: "localhost", From: "no-reply@arouzy.local"}
+	if err := mailer.Send(Message{To: "jane@example.com", Subject: "Hi", Body: "Hello"}); err == nil {
+		t.Error("Send to a closed port succeeded")
+	}
+}
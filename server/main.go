@@ -12,7 +12,12 @@ import (
 
 	"project/server/database"
 	"project/server/handlers"
+	"project/server/imaging"
+	"project/server/mail"
 	"project/server/middleware"
+	"project/server/models"
+	"project/server/oidc"
+	"project/server/storage"
 	"project/server/utils"
 
 	"github.com/gorilla/mux"
@@ -26,6 +31,31 @@ func main() {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	// Run maintenance commands instead of the server when asked to
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrateCommand(os.Args[2:]))
+		case "recount-upvotes":
+			os.Exit(runRecountUpvotesCommand())
+		case "set-role":
+			os.Exit(runSetRoleCommand(os.Args[2:]))
+		case "dev-oidc-provider":
+			os.Exit(runDevOIDCProviderCommand(os.Args[2:]))
+		case "generate-jwt-key":
+			os.Exit(runGenerateJWTKeyCommand(os.Args[2:]))
+		case "strip-metadata":
+			os.Exit(runStripMetadataCommand())
+		case "dev-s3":
+			os.Exit(runDevS3Command(os.Args[2:]))
+		}
+	}
+
+	// Load the token signing keys; this fails in production without a real secret
+	if err := utils.LoadJWTKeys(); err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+
 	// Initialize the database connection
 	pool, err := database.InitDB()
 	if err != nil {
@@ -33,17 +63,25 @@ func main() {
 	}
 	defer pool.Close()
 
-	// Create uploads directory
-	uploadsDir, err := utils.EnsureUploadsDir()
-	if err != nil {
-		log.Printf("Warning: Unable to create uploads directory: %v", err)
-	} else {
-		log.Printf("Using uploads directory: %s", uploadsDir)
-		if utils.IsPersistentStorage() {
-			log.Printf("Using persistent storage - files will survive container restarts")
-		} else {
-			log.Printf("Warning: Using local storage - files may be lost on container restart")
-		}
+	// Choose how emails are delivered
+	mail.Init()
+
+	// Configure external identity providers
+	oidc.LoadProviders(utils.APIURL("/api/auth/oidc"))
+
+	// Choose where uploaded files are stored
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Invalid storage configuration: %v", err)
+	}
+
+	// Choose which photo metadata survives upload
+	if err := imaging.Init(); err != nil {
+		log.Fatalf("Invalid image configuration: %v", err)
+	}
+
+	// Moderators used to be listed in MODERATOR_USER_IDS; they now need a role
+	if os.Getenv("MODERATOR_USER_IDS") != "" {
+		log.Println("MODERATOR_USER_IDS is no longer used; grant moderators their role with `go run . set-role <username> moderator`")
 	}
 
 	// Create the router
@@ -52,6 +90,20 @@ func main() {
 	// Set up API routes
 	apiRouter := router.PathPrefix("/api").Subrouter()
 
+	// Role checks for staff-only routes (used inside AuthMiddleware)
+	requireModerator := middleware.RequireRole(models.RoleModerator, models.RoleAdmin)
+	requireAdmin := middleware.RequireRole(models.RoleAdmin)
+
+	// Scopes under which personal access tokens may use a route (used outside
+	// the auth middleware); routes without one only accept login tokens
+	contentRead := middleware.TokenScope(models.ScopeContentRead)
+	contentWrite := middleware.TokenScope(models.ScopeContentWrite)
+	collectionsScope := middleware.TokenScope(models.ScopeCollections)
+	tradingScope := middleware.TokenScope(models.ScopeTrading)
+
+	// Keys for verifying access tokens
+	router.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler).Methods("GET")
+
 	// Public routes
 	apiRouter.HandleFunc("/health", handlers.HealthCheckHandler).Methods("GET")
 	// Public user profile route
@@ -68,20 +120,75 @@ func main() {
 	authRouter := apiRouter.PathPrefix("/auth").Subrouter()
 	authRouter.HandleFunc("/signup", handlers.SignupHandler).Methods("POST")
 	authRouter.HandleFunc("/login", handlers.LoginHandler).Methods("POST")
+	authRouter.HandleFunc("/login/2fa", handlers.LoginTwoFactorHandler).Methods("POST")
+	authRouter.HandleFunc("/refresh", handlers.RefreshTokenHandler).Methods("POST")
+	authRouter.HandleFunc("/logout", handlers.LogoutHandler).Methods("POST")
+	authRouter.HandleFunc("/forgot-password", handlers.ForgotPasswordHandler).Methods("POST")
+	authRouter.HandleFunc("/reset-password", handlers.ResetPasswordHandler).Methods("POST")
+	authRouter.HandleFunc("/verify-email", handlers.VerifyEmailHandler).Methods("POST")
+	authRouter.HandleFunc("/verify-email/resend", middleware.AuthMiddleware(handlers.ResendVerificationHandler)).Methods("POST")
 	authRouter.HandleFunc("/user", middleware.AuthMiddleware(handlers.GetCurrentUserHandler)).Methods("GET")
+	authRouter.HandleFunc("/sessions", middleware.AuthMiddleware(handlers.ListSessionsHandler)).Methods("GET")
+	authRouter.HandleFunc("/sessions/{id}", middleware.AuthMiddleware(handlers.RevokeSessionHandler)).Methods("DELETE")
+	authRouter.HandleFunc("/2fa/setup", middleware.AuthMiddleware(handlers.SetupTwoFactorHandler)).Methods("POST")
+	authRouter.HandleFunc("/2fa/confirm", middleware.AuthMiddleware(handlers.ConfirmTwoFactorHandler)).Methods("POST")
+	authRouter.HandleFunc("/2fa/recovery-codes", middleware.AuthMiddleware(handlers.RegenerateRecoveryCodesHandler)).Methods("POST")
+	authRouter.HandleFunc("/2fa/disable", middleware.AuthMiddleware(handlers.DisableTwoFactorHandler)).Methods("POST")
+	authRouter.HandleFunc("/oidc/providers", handlers.ListOIDCProvidersHandler).Methods("GET")
+	authRouter.HandleFunc("/oidc/complete", handlers.CompleteOIDCLoginHandler).Methods("POST")
+	authRouter.HandleFunc("/oidc/link", middleware.AuthMiddleware(handlers.ConfirmOIDCLinkHandler)).Methods("POST")
+	authRouter.HandleFunc("/oidc/{provider}/start", handlers.StartOIDCLoginHandler).Methods("GET")
+	authRouter.HandleFunc("/oidc/{provider}/link", middleware.AuthMiddleware(handlers.StartOIDCLinkHandler)).Methods("POST")
+	authRouter.HandleFunc("/oidc/{provider}/callback", handlers.OIDCCallbackHandler).Methods("GET")
+	authRouter.HandleFunc("/identities", middleware.AuthMiddleware(handlers.ListIdentitiesHandler)).Methods("GET")
+	authRouter.HandleFunc("/identities/{id}", middleware.AuthMiddleware(handlers.UnlinkIdentityHandler)).Methods("DELETE")
 
 	// Content routes
 	contentRouter := apiRouter.PathPrefix("/content").Subrouter()
-	contentRouter.HandleFunc("/", handlers.GetContentHandler).Methods("GET")
-	contentRouter.HandleFunc("/{id}", handlers.GetContentByIdHandler).Methods("GET")
-	contentRouter.HandleFunc("", middleware.AuthMiddleware(handlers.CreateContentHandler)).Methods("POST")
+	contentRouter.HandleFunc("/", contentRead(middleware.OptionalAuthMiddleware(handlers.GetContentHandler))).Methods("GET")
+	contentRouter.HandleFunc("/{id}", contentRead(middleware.OptionalAuthMiddleware(handlers.GetContentByIdHandler))).Methods("GET")
+	contentRouter.HandleFunc("", contentWrite(middleware.AuthMiddleware(middleware.RequireVerifiedEmail(handlers.CreateContentHandler)))).Methods("POST")
+	contentRouter.HandleFunc("/{id}", contentWrite(middleware.AuthMiddleware(handlers.UpdateContentHandler))).Methods("PUT")
+	contentRouter.HandleFunc("/{id}", contentWrite(middleware.AuthMiddleware(handlers.DeleteContentHandler))).Methods("DELETE")
+	contentRouter.HandleFunc("/{id}/upvote", contentWrite(middleware.AuthMiddleware(handlers.UpvoteContentHandler))).Methods("POST")
+	contentRouter.HandleFunc("/{id}/upvote", contentWrite(middleware.AuthMiddleware(handlers.RemoveUpvoteHandler))).Methods("DELETE")
+	contentRouter.HandleFunc("/{id}/comments", middleware.OptionalAuthMiddleware(handlers.ListContentCommentsHandler)).Methods("GET")
+	contentRouter.HandleFunc("/{id}/comments", contentWrite(middleware.AuthMiddleware(handlers.CreateCommentHandler))).Methods("POST")
+
+	// Comment routes
+	commentsRouter := apiRouter.PathPrefix("/comments").Subrouter()
+	commentsRouter.HandleFunc("/{id}/replies", middleware.OptionalAuthMiddleware(handlers.ListCommentRepliesHandler)).Methods("GET")
+	commentsRouter.HandleFunc("/{id}", contentWrite(middleware.AuthMiddleware(handlers.UpdateCommentHandler))).Methods("PUT")
+	commentsRouter.HandleFunc("/{id}", contentWrite(middleware.AuthMiddleware(handlers.DeleteCommentHandler))).Methods("DELETE")
+
+	// Personalized feed of followed accounts
+	apiRouter.HandleFunc("/feed", contentRead(middleware.AuthMiddleware(handlers.GetFollowingFeedHandler))).Methods("GET")
+
+	// Reports and moderation routes
+	apiRouter.HandleFunc("/reports", middleware.AuthMiddleware(handlers.CreateReportHandler)).Methods("POST")
+	moderationRouter := apiRouter.PathPrefix("/moderation").Subrouter()
+	moderationRouter.HandleFunc("/reports", middleware.AuthMiddleware(requireModerator(handlers.ListReportsHandler))).Methods("GET")
+	moderationRouter.HandleFunc("/reports/{id}/resolve", middleware.AuthMiddleware(requireModerator(handlers.ResolveReportHandler))).Methods("POST")
+	moderationRouter.HandleFunc("/content/{id}", middleware.AuthMiddleware(requireModerator(handlers.UpdateContentModerationHandler))).Methods("PUT")
+
+	// Admin routes
+	adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.HandleFunc("/statistics", middleware.AuthMiddleware(requireModerator(handlers.GetAdminStatisticsHandler))).Methods("GET")
+	adminRouter.HandleFunc("/content", middleware.AuthMiddleware(requireModerator(handlers.ListAdminContentHandler))).Methods("GET")
+	adminRouter.HandleFunc("/content/{id}", middleware.AuthMiddleware(requireModerator(handlers.AdminDeleteContentHandler))).Methods("DELETE")
+	adminRouter.HandleFunc("/users", middleware.AuthMiddleware(requireAdmin(handlers.ListAdminUsersHandler))).Methods("GET")
+	adminRouter.HandleFunc("/users/{id}", middleware.AuthMiddleware(requireAdmin(handlers.AdminDeleteUserHandler))).Methods("DELETE")
+	adminRouter.HandleFunc("/users/{id}/suspend", middleware.AuthMiddleware(requireAdmin(handlers.SuspendUserHandler))).Methods("POST")
+	adminRouter.HandleFunc("/users/{id}/unsuspend", middleware.AuthMiddleware(requireAdmin(handlers.UnsuspendUserHandler))).Methods("POST")
+	adminRouter.HandleFunc("/users/{id}/unlock-login", middleware.AuthMiddleware(requireAdmin(handlers.UnlockUserLoginHandler))).Methods("POST")
+	adminRouter.HandleFunc("/security/attacked-accounts", middleware.AuthMiddleware(requireAdmin(handlers.ListAttackedAccountsHandler))).Methods("GET")
 
 	// Tags route
 	apiRouter.HandleFunc("/tags", handlers.GetTagsHandler).Methods("GET")
 
 	// Search routes
 	searchRouter := apiRouter.PathPrefix("/search").Subrouter()
-	searchRouter.HandleFunc("/content", handlers.SearchContentHandler).Methods("GET")
+	searchRouter.HandleFunc("/content", contentRead(middleware.OptionalAuthMiddleware(handlers.SearchContentHandler))).Methods("GET")
 	searchRouter.HandleFunc("/suggestions", handlers.SearchSuggestionsHandler).Methods("GET")
 
 	// User routes
@@ -89,37 +196,44 @@ func main() {
 	userRouter.HandleFunc("/profile", middleware.AuthMiddleware(handlers.GetUserProfileHandler)).Methods("GET")
 	userRouter.HandleFunc("/profile", middleware.AuthMiddleware(handlers.UpdateUserProfileHandler)).Methods("PUT")
 	userRouter.HandleFunc("/dashboard", middleware.AuthMiddleware(handlers.GetUserDashboardHandler)).Methods("GET")
+	userRouter.HandleFunc("/tokens", middleware.AuthMiddleware(handlers.ListAPITokensHandler)).Methods("GET")
+	userRouter.HandleFunc("/tokens", middleware.AuthMiddleware(handlers.CreateAPITokenHandler)).Methods("POST")
+	userRouter.HandleFunc("/tokens/{id}", middleware.AuthMiddleware(handlers.RevokeAPITokenHandler)).Methods("DELETE")
+	userRouter.HandleFunc("/export", middleware.AuthMiddleware(handlers.ExportUserDataHandler)).Methods("GET")
+	userRouter.HandleFunc("/deletion", middleware.AuthMiddleware(handlers.GetAccountDeletionHandler)).Methods("GET")
+	userRouter.HandleFunc("/deletion", middleware.AuthMiddleware(handlers.RequestAccountDeletionHandler)).Methods("POST")
+	userRouter.HandleFunc("/deletion", middleware.AuthMiddleware(handlers.CancelAccountDeletionHandler)).Methods("DELETE")
 
 	// File upload routes
-	apiRouter.HandleFunc("/upload", handlers.UploadHandler).Methods("POST", "OPTIONS")
-	apiRouter.HandleFunc("/upload/multiple", handlers.MultipleUploadHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/upload", contentWrite(middleware.AuthMiddleware(middleware.RequireVerifiedEmail(handlers.UploadHandler)))).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/upload/multiple", contentWrite(middleware.AuthMiddleware(middleware.RequireVerifiedEmail(handlers.MultipleUploadHandler)))).Methods("POST", "OPTIONS")
 	// Serve uploaded files
-	router.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir(uploadsDir))))
+	router.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.HandlerFunc(handlers.ServeUploadHandler)))
 
 	// Trading routes
 	tradingRouter := apiRouter.PathPrefix("/trading").Subrouter()
-	tradingRouter.HandleFunc("/upload", middleware.AuthMiddleware(handlers.UploadTradingContentHandler)).Methods("POST")
-	tradingRouter.HandleFunc("", middleware.AuthMiddleware(handlers.ListTradingContentHandler)).Methods("GET")
-	tradingRouter.HandleFunc("/mine", middleware.AuthMiddleware(handlers.ListMyTradingContentHandler)).Methods("GET")
-	tradingRouter.HandleFunc("/request", middleware.AuthMiddleware(handlers.SendTradeRequestHandler)).Methods("POST")
-	tradingRouter.HandleFunc("/requests", middleware.AuthMiddleware(handlers.ListTradeRequestsHandler)).Methods("GET")
-	tradingRouter.HandleFunc("/request/{id}/accept", middleware.AuthMiddleware(handlers.AcceptTradeRequestHandler)).Methods("POST")
-	tradingRouter.HandleFunc("/request/{id}/reject", middleware.AuthMiddleware(handlers.RejectTradeRequestHandler)).Methods("POST")
+	tradingRouter.HandleFunc("/upload", tradingScope(middleware.AuthMiddleware(middleware.RequireVerifiedEmail(handlers.UploadTradingContentHandler)))).Methods("POST")
+	tradingRouter.HandleFunc("", tradingScope(middleware.AuthMiddleware(handlers.ListTradingContentHandler))).Methods("GET")
+	tradingRouter.HandleFunc("/mine", tradingScope(middleware.AuthMiddleware(handlers.ListMyTradingContentHandler))).Methods("GET")
+	tradingRouter.HandleFunc("/request", tradingScope(middleware.AuthMiddleware(middleware.RequireVerifiedEmail(handlers.SendTradeRequestHandler)))).Methods("POST")
+	tradingRouter.HandleFunc("/requests", tradingScope(middleware.AuthMiddleware(handlers.ListTradeRequestsHandler))).Methods("GET")
+	tradingRouter.HandleFunc("/request/{id}/accept", tradingScope(middleware.AuthMiddleware(handlers.AcceptTradeRequestHandler))).Methods("POST")
+	tradingRouter.HandleFunc("/request/{id}/reject", tradingScope(middleware.AuthMiddleware(handlers.RejectTradeRequestHandler))).Methods("POST")
 
-	// Debug route (remove in production)
-	tradingRouter.HandleFunc("/debug/requests", handlers.DebugTradeRequestsHandler).Methods("GET")
+	// Debug route (admin only)
+	tradingRouter.HandleFunc("/debug/requests", middleware.AuthMiddleware(requireAdmin(handlers.DebugTradeRequestsHandler))).Methods("GET")
 
 	// Collections routes
 	collectionsRouter := apiRouter.PathPrefix("/collections").Subrouter()
-	collectionsRouter.HandleFunc("", middleware.AuthMiddleware(handlers.CreateCollectionHandler)).Methods("POST")
-	collectionsRouter.HandleFunc("/my", middleware.AuthMiddleware(handlers.ListMyCollectionsHandler)).Methods("GET")
+	collectionsRouter.HandleFunc("", collectionsScope(middleware.AuthMiddleware(handlers.CreateCollectionHandler))).Methods("POST")
+	collectionsRouter.HandleFunc("/my", collectionsScope(middleware.AuthMiddleware(handlers.ListMyCollectionsHandler))).Methods("GET")
 	collectionsRouter.HandleFunc("/public", handlers.ListPublicCollectionsHandler).Methods("GET")
-	collectionsRouter.HandleFunc("/content", middleware.OptionalAuthMiddleware(handlers.GetCollectionContentHandler)).Methods("GET")
-	collectionsRouter.HandleFunc("/save", middleware.AuthMiddleware(handlers.SaveToCollectionHandler)).Methods("POST")
-	collectionsRouter.HandleFunc("/remove", middleware.AuthMiddleware(handlers.RemoveFromCollectionHandler)).Methods("DELETE")
-	collectionsRouter.HandleFunc("/update", middleware.AuthMiddleware(handlers.UpdateCollectionHandler)).Methods("PUT")
-	collectionsRouter.HandleFunc("/delete", middleware.AuthMiddleware(handlers.DeleteCollectionHandler)).Methods("DELETE")
-	collectionsRouter.HandleFunc("/detail/{id}", middleware.OptionalAuthMiddleware(handlers.GetCollectionHandler)).Methods("GET")
+	collectionsRouter.HandleFunc("/content", collectionsScope(middleware.OptionalAuthMiddleware(handlers.GetCollectionContentHandler))).Methods("GET")
+	collectionsRouter.HandleFunc("/save", collectionsScope(middleware.AuthMiddleware(handlers.SaveToCollectionHandler))).Methods("POST")
+	collectionsRouter.HandleFunc("/remove", collectionsScope(middleware.AuthMiddleware(handlers.RemoveFromCollectionHandler))).Methods("DELETE")
+	collectionsRouter.HandleFunc("/update", collectionsScope(middleware.AuthMiddleware(handlers.UpdateCollectionHandler))).Methods("PUT")
+	collectionsRouter.HandleFunc("/delete", collectionsScope(middleware.AuthMiddleware(handlers.DeleteCollectionHandler))).Methods("DELETE")
+	collectionsRouter.HandleFunc("/detail/{id}", collectionsScope(middleware.OptionalAuthMiddleware(handlers.GetCollectionHandler))).Methods("GET")
 
 	// Messages routes - REMOVED: Chat functionality moved to separate Node.js server
 	// messagesRouter := apiRouter.PathPrefix("/messages").Subrouter()
@@ -152,6 +266,12 @@ func main() {
 		Handler:      c.Handler(router),
 	}
 
+	// Purge accounts whose deletion grace period has ended and resize uploaded images
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go handlers.RunAccountDeletions(workerCtx)
+	go handlers.RunImageVariants(workerCtx)
+
 	// Start the server in a goroutine
 	go func() {
 		fmt.Printf("Server running on port %s\n", port)
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"project/server/database"
+	"project/server/imaging"
+	"project/server/models"
+	"project/server/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runRecountUpvotesCommand handles "server recount-upvotes" and returns the process exit code
+func runRecountUpvotesCommand() int {
+	pool, err := database.Connect()
+	if err != nil {
+		log.Printf("Unable to connect to database: %v", err)
+		return 1
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	corrected, err := database.RecountUpvotes(ctx, pool)
+	if err != nil {
+		log.Printf("Recount failed: %v", err)
+		return 1
+	}
+	fmt.Printf("Corrected upvote counts on %d content item(s)\n", corrected)
+
+	return 0
+}
+
+// runSetRoleCommand handles "server set-role <username> <role>" and returns the process exit code
+func runSetRoleCommand(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: server set-role <username> <user|moderator|admin>")
+		return 2
+	}
+	username, role := args[0], args[1]
+	switch role {
+	case models.RoleUser, models.RoleModerator, models.RoleAdmin:
+	default:
+		fmt.Fprintln(os.Stderr, "Role must be one of: user, moderator, admin")
+		return 2
+	}
+
+	pool, err := database.Connect()
+	if err != nil {
+		log.Printf("Unable to connect to database: %v", err)
+		return 1
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := pool.Exec(ctx, `UPDATE users SET role = $1, updated_at = NOW() WHERE username = $2`, role, username)
+	if err != nil {
+		log.Printf("Unable to update role: %v", err)
+		return 1
+	}
+	if res.RowsAffected() == 0 {
+		fmt.Fprintf(os.Stderr, "User %q not found\n", username)
+		return 1
+	}
+	fmt.Printf("%s is now %s (takes effect on their next login)\n", username, role)
+
+	return 0
+}
+
+// runGenerateJWTKeyCommand handles "server generate-jwt-key [eddsa|rs256]". It
+// prints a new PKCS#8 private key for JWT_PRIVATE_KEY to stdout and returns
+// the process exit code.
+func runGenerateJWTKeyCommand(args []string) int {
+	alg := "eddsa"
+	if len(args) > 0 {
+		alg = strings.ToLower(args[0])
+	}
+
+	var key interface{}
+	var err error
+	switch alg {
+	case "eddsa":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "rs256":
+		key, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: server generate-jwt-key [eddsa|rs256]")
+		return 2
+	}
+	if err != nil {
+		log.Printf("Error generating key: %v", err)
+		return 1
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		log.Printf("Error encoding key: %v", err)
+		return 1
+	}
+	pem.Encode(os.Stdout, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return 0
+}
+
+// runStripMetadataCommand handles "server strip-metadata". It removes EXIF,
+// XMP and IPTC metadata from images stored before uploads were cleaned, and
+// returns the process exit code.
+func runStripMetadataCommand() int {
+	if err := storage.Init(); err != nil {
+		log.Printf("Invalid storage configuration: %v", err)
+		return 1
+	}
+	if err := imaging.Init(); err != nil {
+		log.Printf("Invalid image configuration: %v", err)
+		return 1
+	}
+
+	pool, err := database.Connect()
+	if err != nil {
+		log.Printf("Unable to connect to database: %v", err)
+		return 1
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+
+	// Every stored file rows point at, including those from before uploads were recorded
+	rows, err := pool.Query(ctx, `
+		SELECT url FROM uploads
+		UNION SELECT image_url FROM content_images
+		UNION SELECT thumbnail_url FROM content WHERE thumbnail_url IS NOT NULL
+		UNION SELECT file_url FROM trading_content
+		UNION SELECT attachment_url FROM messages WHERE attachment_url IS NOT NULL
+	`)
+	if err != nil {
+		log.Printf("Unable to list files: %v", err)
+		return 1
+	}
+	urls, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Printf("Unable to list files: %v", err)
+		return 1
+	}
+
+	var cleaned, failed int
+	for _, url := range urls {
+		key, ok := storage.KeyFromURL(url)
+		if !ok {
+			continue
+		}
+		changed, err := stripStoredFile(ctx, pool, url, key)
+		if err != nil {
+			log.Printf("Error cleaning %s: %v", key, err)
+			failed++
+			continue
+		}
+		if changed {
+			cleaned++
+		}
+	}
+	fmt.Printf("Removed metadata from %d of %d file(s)\n", cleaned, len(urls))
+	if failed > 0 {
+		fmt.Printf("%d file(s) could not be cleaned\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// stripStoredFile rewrites one stored image without its metadata, updating its
+// uploads row, and reports whether anything was removed. Other files are left alone.
+func stripStoredFile(ctx context.Context, pool *pgxpool.Pool, url, key string) (bool, error) {
+	src, _, err := storage.Default.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	data, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		return false, err
+	}
+
+	contentType := http.DetectContentType(data)
+	stripped, err := imaging.StripMetadata(data, contentType)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(stripped, data) {
+		return false, nil
+	}
+
+	if err := storage.Default.Put(ctx, key, bytes.NewReader(stripped), int64(len(stripped)), contentType); err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(stripped)
+	_, err = pool.Exec(ctx, `UPDATE uploads SET size_bytes = $1, checksum = $2 WHERE url = $3`,
+		len(stripped), hex.EncodeToString(sum[:]), url)
+	return true, err
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"project/server/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// suspensionCheckInterval is how long a user's suspension state is cached,
+	// so a suspension made on another instance applies here within it
+	suspensionCheckInterval = 30 * time.Second
+	// activityInterval is how often a user's last_active_at is written
+	activityInterval = 5 * time.Minute
+)
+
+var (
+	// activityCache holds whether recently checked users are suspended
+	activityCache = newFlagCache(suspensionCheckInterval)
+	// activitySeen holds the users whose last_active_at was written recently
+	activitySeen = newFlagCache(activityInterval)
+)
+
+// isSuspended records activity for an authenticated user and reports whether
+// their account is suspended or no longer exists. Errors are returned rather
+// than guessed at, so callers can refuse the request.
+func isSuspended(ctx context.Context, userID int) (bool, error) {
+	if suspended, ok := activityCache.get(userID); ok {
+		return suspended, nil
+	}
+
+	var suspended bool
+	var err error
+	if _, seen := activitySeen.get(userID); seen {
+		err = database.DBPool.QueryRow(ctx, `
+			SELECT suspended_at IS NOT NULL FROM users WHERE id = $1
+		`, userID).Scan(&suspended)
+	} else {
+		err = database.DBPool.QueryRow(ctx, `
+			UPDATE users SET last_active_at = NOW() WHERE id = $1
+			RETURNING suspended_at IS NOT NULL
+		`, userID).Scan(&suspended)
+		if err == nil {
+			activitySeen.set(userID, true)
+		}
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The account was deleted
+		suspended = true
+	} else if err != nil {
+		return false, err
+	}
+
+	SetSuspended(userID, suspended)
+	return suspended, nil
+}
+
+// SetSuspended updates the cached suspension state for a user, so suspensions
+// take effect immediately on the instance that applied them
+func SetSuspended(userID int, suspended bool) {
+	activityCache.set(userID, suspended)
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"strings"
 
@@ -9,7 +10,7 @@ import (
 	"project/server/utils"
 )
 
-// AuthMiddleware verifies the JWT token and adds the user to the request context
+// AuthMiddleware verifies the JWT or personal access token and adds the user to the request context
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get the Authorization header
@@ -28,6 +29,17 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		tokenString := tokenParts[1]
 
+		// Personal access tokens are checked against the route's token scope
+		if strings.HasPrefix(tokenString, utils.APITokenPrefix) {
+			ctx, status, message := authenticateAPIToken(r, tokenString)
+			if status != 0 {
+				http.Error(w, message, status)
+				return
+			}
+			next(w, r.WithContext(ctx))
+			return
+		}
+
 		// Validate the token
 		claims, err := utils.ValidateJWT(tokenString)
 		if err != nil {
@@ -40,10 +52,38 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			ID:       claims.UserID,
 			Username: claims.Username,
 			Email:    claims.Email,
+			Role:     roleFromClaims(claims),
+		}
+
+		// Reject tokens of sessions that were signed out
+		if claims.SessionID != 0 {
+			revoked, err := isSessionRevoked(r.Context(), claims.SessionID)
+			if err != nil {
+				log.Printf("Error checking session %d: %v", claims.SessionID, err)
+				http.Error(w, "Unable to verify session, please try again", http.StatusServiceUnavailable)
+				return
+			}
+			if revoked {
+				http.Error(w, "Session has been revoked", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// Reject suspended accounts
+		suspended, err := isSuspended(r.Context(), user.ID)
+		if err != nil {
+			log.Printf("Error recording activity for user %d: %v", user.ID, err)
+			http.Error(w, "Unable to verify session, please try again", http.StatusServiceUnavailable)
+			return
+		}
+		if suspended {
+			http.Error(w, "Account suspended", http.StatusForbidden)
+			return
 		}
 
-		// Add user to request context
+		// Add user and session to request context
 		ctx := context.WithValue(r.Context(), models.UserContextKey, user)
+		ctx = context.WithValue(ctx, models.SessionContextKey, claims.SessionID)
 
 		// Call the next handler with the updated context
 		next(w, r.WithContext(ctx))
@@ -58,14 +98,25 @@ func OptionalAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			tokenParts := strings.Split(authHeader, " ")
 			if len(tokenParts) == 2 && tokenParts[0] == "Bearer" {
 				tokenString := tokenParts[1]
+				if strings.HasPrefix(tokenString, utils.APITokenPrefix) {
+					// A refused API token leaves the request anonymous
+					if ctx, status, _ := authenticateAPIToken(r, tokenString); status == 0 {
+						r = r.WithContext(ctx)
+					}
+					next(w, r)
+					return
+				}
+				// Tokens that cannot be checked leave the request anonymous
 				claims, err := utils.ValidateJWT(tokenString)
-				if err == nil {
+				if err == nil && optionalSessionValid(r.Context(), claims) {
 					user := models.User{
 						ID:       claims.UserID,
 						Username: claims.Username,
 						Email:    claims.Email,
+						Role:     roleFromClaims(claims),
 					}
 					ctx := context.WithValue(r.Context(), models.UserContextKey, user)
+					ctx = context.WithValue(ctx, models.SessionContextKey, claims.SessionID)
 					r = r.WithContext(ctx)
 				}
 			}
@@ -73,3 +124,32 @@ func OptionalAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// optionalSessionValid reports whether an optional token's session is active
+// and its account not suspended, treating errors as not
+func optionalSessionValid(ctx context.Context, claims *utils.CustomClaims) bool {
+	if claims.SessionID != 0 {
+		revoked, err := isSessionRevoked(ctx, claims.SessionID)
+		if err != nil {
+			log.Printf("Error checking session %d: %v", claims.SessionID, err)
+			return false
+		}
+		if revoked {
+			return false
+		}
+	}
+	suspended, err := isSuspended(ctx, claims.UserID)
+	if err != nil {
+		log.Printf("Error recording activity for user %d: %v", claims.UserID, err)
+		return false
+	}
+	return !suspended
+}
+
+// roleFromClaims returns the role in a token, treating tokens issued before roles existed as plain users
+func roleFromClaims(claims *utils.CustomClaims) string {
+	if claims.Role == "" {
+		return models.RoleUser
+	}
+	return claims.Role
+}
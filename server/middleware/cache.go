@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// flagCache remembers a boolean per ID for ttl. Entries that have expired are
+// swept out at most once per ttl, so it only holds IDs seen recently.
+type flagCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	flags   map[int]cachedFlag
+	sweptAt time.Time
+}
+
+type cachedFlag struct {
+	value    bool
+	storedAt time.Time
+}
+
+func newFlagCache(ttl time.Duration) *flagCache {
+	return &flagCache{ttl: ttl, flags: make(map[int]cachedFlag)}
+}
+
+// get returns the flag stored for id if it has not expired
+func (c *flagCache) get(id int) (value, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	flag, ok := c.flags[id]
+	if !ok || time.Since(flag.storedAt) >= c.ttl {
+		return false, false
+	}
+	return flag.value, true
+}
+
+// set stores the flag for id
+func (c *flagCache) set(id int, value bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.flags[id] = cachedFlag{value: value, storedAt: now}
+
+	if now.Sub(c.sweptAt) < c.ttl {
+		return
+	}
+	c.sweptAt = now
+	for id, flag := range c.flags {
+		if now.Sub(flag.storedAt) >= c.ttl {
+			delete(c.flags, id)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"project/server/models"
+)
+
+// RequireRole only lets through users holding one of the given roles.
+// It must run after AuthMiddleware, which loads the role from the token.
+func RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			user, ok := r.Context().Value(models.UserContextKey).(models.User)
+			if !ok {
+				http.Error(w, "Authorization required", http.StatusUnauthorized)
+				return
+			}
+
+			for _, role := range roles {
+				if user.Role == role {
+					next(w, r)
+					return
+				}
+			}
+
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"project/server/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// sessionCheckInterval is how long a session's revocation state is cached.
+	// Sign-outs are recorded in the database, so one made on another instance
+	// applies here within this interval.
+	sessionCheckInterval = 10 * time.Second
+	// sessionSeenInterval is how often a session's last_seen_at is written
+	sessionSeenInterval = time.Minute
+)
+
+var (
+	// sessionCache holds whether recently checked sessions are revoked
+	sessionCache = newFlagCache(sessionCheckInterval)
+	// sessionSeen holds the sessions whose last_seen_at was written recently
+	sessionSeen = newFlagCache(sessionSeenInterval)
+)
+
+// isSessionRevoked records that a session was used and reports whether it has
+// been revoked or has expired. Errors are returned rather than guessed at, so
+// callers can refuse the request instead of trusting a stale answer.
+func isSessionRevoked(ctx context.Context, sessionID int) (bool, error) {
+	if revoked, ok := sessionCache.get(sessionID); ok {
+		return revoked, nil
+	}
+
+	var revoked bool
+	var err error
+	if _, seen := sessionSeen.get(sessionID); seen {
+		err = database.DBPool.QueryRow(ctx, `
+			SELECT revoked_at IS NOT NULL OR expires_at < NOW() FROM sessions WHERE id = $1
+		`, sessionID).Scan(&revoked)
+	} else {
+		err = database.DBPool.QueryRow(ctx, `
+			UPDATE sessions SET last_seen_at = NOW() WHERE id = $1
+			RETURNING revoked_at IS NOT NULL OR expires_at < NOW()
+		`, sessionID).Scan(&revoked)
+		if err == nil {
+			sessionSeen.set(sessionID, true)
+		}
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The session (or its user) was deleted
+		revoked = true
+	} else if err != nil {
+		return false, err
+	}
+
+	sessionCache.set(sessionID, revoked)
+	return revoked, nil
+}
+
+// SetSessionRevoked marks a session revoked in the cache, so a sign-out takes
+// effect immediately on the instance that applied it. Other instances read it
+// from the database within sessionCheckInterval.
+func SetSessionRevoked(sessionID int) {
+	sessionCache.set(sessionID, true)
+}
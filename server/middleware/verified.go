@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"project/server/database"
+	"project/server/models"
+)
+
+// RequireVerifiedEmail only lets through users who have confirmed their email
+// address. It must run after AuthMiddleware.
+func RequireVerifiedEmail(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(models.UserContextKey).(models.User)
+		if !ok {
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+
+		var verified bool
+		err := database.DBPool.QueryRow(r.Context(),
+			"SELECT verified_at IS NOT NULL FROM users WHERE id = $1", user.ID,
+		).Scan(&verified)
+		if err != nil {
+			log.Printf("Error checking email verification for user %d: %v", user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if !verified {
+			http.Error(w, "Please verify your email address first", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"project/server/database"
+)
+
+const migrateUsage = `Usage: server migrate <command>
+
+Commands:
+  up          apply all pending migrations
+  down [n]    revert the last n applied migrations (default 1)
+  status      list migrations and when they were applied`
+
+// runMigrateCommand handles "server migrate ..." and returns the process exit code
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	pool, err := database.Connect()
+	if err != nil {
+		log.Printf("Unable to connect to database: %v", err)
+		return 1
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(ctx, pool)
+		if err != nil {
+			log.Printf("Migration failed: %v", err)
+			return 1
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "down expects a positive number of steps")
+				return 2
+			}
+		}
+		reverted, err := database.MigrateDown(ctx, pool, steps)
+		if err != nil {
+			log.Printf("Migration failed: %v", err)
+			return 1
+		}
+		fmt.Printf("Reverted %d migration(s)\n", reverted)
+
+	case "status":
+		states, err := database.GetMigrationStatus(ctx, pool)
+		if err != nil {
+			log.Printf("Unable to read migration status: %v", err)
+			return 1
+		}
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.AppliedAt != nil {
+				appliedAt = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-40s  %s\n", state.Version, state.Name, appliedAt)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,71 @@
+package models
+
+// AdminStatistics represents the site-wide numbers shown on the admin dashboard
+type AdminStatistics struct {
+	TotalUsers        int `json:"totalUsers"`
+	ActiveUsers30Days int `json:"activeUsers30Days"`
+	NewSignups30Days  int `json:"newSignups30Days"`
+	TotalThreads      int `json:"totalThreads"`
+	TotalPosts        int `json:"totalPosts"`
+	PendingModeration int `json:"pendingModeration"`
+}
+
+// AdminUser represents a user as listed in the admin panel
+type AdminUser struct {
+	ID               int    `json:"id"`
+	Username         string `json:"username"`
+	Email            string `json:"email"`
+	JoinDate         string `json:"joinDate"`
+	LastActive       string `json:"lastActive,omitempty"`
+	Usergroup        string `json:"usergroup"`
+	PostsCount       int    `json:"postsCount"`
+	SuspendedAt      string `json:"suspendedAt,omitempty"`
+	SuspensionReason string `json:"suspensionReason,omitempty"`
+}
+
+// AdminUserResponse represents the API response for admin user listings
+type AdminUserResponse struct {
+	Users      []AdminUser `json:"users"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// AdminContent represents a content item (thread) as listed in the admin panel
+type AdminContent struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	Photos     int    `json:"photos"`
+	Videos     int    `json:"videos"`
+	DatePosted string `json:"datePosted"`
+	Status     string `json:"status"` // active, awaiting_moderation, archived
+	Replies    int    `json:"replies"`
+}
+
+// AdminContentResponse represents the API response for admin content listings
+type AdminContentResponse struct {
+	Threads    []AdminContent `json:"threads"`
+	Pagination Pagination     `json:"pagination"`
+}
+
+// SuspendUserRequest represents the request to suspend a user
+type SuspendUserRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// AttackedAccount summarizes recent failed logins against one account
+type AttackedAccount struct {
+	UserID        int    `json:"userId"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Failures      int    `json:"failures"`
+	Lockouts      int    `json:"lockouts"`
+	DistinctIPs   int    `json:"distinctIps"`
+	LastFailureAt string `json:"lastFailureAt"`
+	LockedUntil   string `json:"lockedUntil,omitempty"`
+}
+
+// AttackedAccountsResponse represents the API response for attacked account listings
+type AttackedAccountsResponse struct {
+	Accounts []AttackedAccount `json:"accounts"`
+	Since    string            `json:"since"`
+}
@@ -15,8 +15,97 @@ type LoginRequest struct {
 
 // AuthResponse represents the response after a successful authentication
 type AuthResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // access token lifetime in seconds
+	User         User   `json:"user"`
+}
+
+// ForgotPasswordRequest asks for a password reset link to be emailed
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest sets a new password using an emailed reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// VerifyEmailRequest confirms an email address using the emailed link's token
+type VerifyEmailRequest struct {
 	Token string `json:"token"`
-	User  User   `json:"user"`
+}
+
+// TwoFactorChallengeResponse is returned by login instead of tokens when the
+// account has two-factor authentication enabled
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+	ExpiresIn         int    `json:"expiresIn"` // seconds
+}
+
+// TwoFactorLoginRequest completes a login with a TOTP or recovery code
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+// TwoFactorSetupResponse carries a new TOTP secret to add to an authenticator app
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthUri"`
+}
+
+// TwoFactorCodeRequest carries a TOTP or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// DisableTwoFactorRequest turns two-factor authentication off
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// RecoveryCodesResponse lists newly generated recovery codes; they are only shown once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// OIDCLinkStartResponse carries the URL to open in the browser to link a provider account
+type OIDCLinkStartResponse struct {
+	StartURL string `json:"startUrl"`
+}
+
+// OIDCCompleteRequest finishes a provider login with the token the callback
+// handed to the frontend. Username is needed the first time a provider
+// account signs in.
+type OIDCCompleteRequest struct {
+	Token    string `json:"token"`
+	Username string `json:"username,omitempty"`
+}
+
+// OIDCSignupRequired asks the frontend to pick a username for a new account
+type OIDCSignupRequired struct {
+	UsernameRequired  bool   `json:"usernameRequired"`
+	Provider          string `json:"provider"`
+	Email             string `json:"email"`
+	SuggestedUsername string `json:"suggestedUsername"`
+}
+
+// LinkedIdentity is an external provider account linked to a user
+type LinkedIdentity struct {
+	ID          int    `json:"id"`
+	Provider    string `json:"provider"`
+	Email       string `json:"email"`
+	CreatedAt   string `json:"createdAt"`
+	LastLoginAt string `json:"lastLoginAt,omitempty"`
+}
+
+// RefreshRequest carries a refresh token to rotate or revoke
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
 // User represents a user in the system
@@ -24,6 +113,62 @@ type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	Role     string `json:"role,omitempty"` // user, moderator, admin
+	// EmailVerified is only set when the account itself is returned to its owner
+	EmailVerified *bool `json:"emailVerified,omitempty"`
+}
+
+// User roles
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Session represents a signed-in device or browser
+type Session struct {
+	ID         int    `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	IPAddress  string `json:"ipAddress"`
+	CreatedAt  string `json:"createdAt"`
+	LastSeenAt string `json:"lastSeenAt"`
+	Current    bool   `json:"current"` // the session making the request
+}
+
+// API token scopes. Login tokens may use every endpoint; personal access
+// tokens only reach endpoints that accept one of their scopes.
+const (
+	ScopeContentRead  = "content:read"
+	ScopeContentWrite = "content:write"
+	ScopeCollections  = "collections"
+	ScopeTrading      = "trading"
+)
+
+// APITokenScopes lists every scope a personal access token can be given
+var APITokenScopes = []string{ScopeContentRead, ScopeContentWrite, ScopeCollections, ScopeTrading}
+
+// APIToken is a personal access token as listed in the settings API
+type APIToken struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"createdAt"`
+	ExpiresAt  string   `json:"expiresAt,omitempty"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+}
+
+// CreateAPITokenRequest represents the request to create a personal access token
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays,omitempty"` // 0 means the token never expires
+}
+
+// CreateAPITokenResponse returns a new token; the secret is only shown once
+type CreateAPITokenResponse struct {
+	Token    string   `json:"token"`
+	APIToken APIToken `json:"apiToken"`
 }
 
 // UserProfile represents detailed user information
@@ -33,14 +178,39 @@ type UserProfile struct {
 	UpvotesGiven  int  `json:"upvotesGiven"`
 }
 
-// UpdateUserRequest represents the request to update user profile
+// UpdateUserRequest represents the request to update user profile. Changing
+// the email or password requires CurrentPassword and, when two-factor
+// authentication is enabled, Code.
 type UpdateUserRequest struct {
-	Username string `json:"username,omitempty"`
-	Email    string `json:"email,omitempty"`
+	Username        string `json:"username,omitempty"`
+	Email           string `json:"email,omitempty"`
+	Password        string `json:"password,omitempty"`
+	CurrentPassword string `json:"currentPassword,omitempty"`
+	Code            string `json:"code,omitempty"`
+}
+
+// DeleteAccountRequest confirms a request to delete the authenticated account.
+// Password is required for accounts that have one and Code when two-factor
+// authentication is enabled.
+type DeleteAccountRequest struct {
 	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// AccountDeletionStatus reports whether an account is scheduled for deletion
+type AccountDeletionStatus struct {
+	Scheduled    bool   `json:"scheduled"`
+	RequestedAt  string `json:"requestedAt,omitempty"`
+	ScheduledFor string `json:"scheduledFor,omitempty"`
 }
 
 // UserContextKey is the key used to store/retrieve user from context
 type userContextKey string
 
 const UserContextKey userContextKey = "user"
+
+// SessionContextKey stores the ID of the session the request's token belongs to
+const SessionContextKey userContextKey = "session"
+
+// TokenScopeContextKey stores the scope a route grants personal access tokens
+const TokenScopeContextKey userContextKey = "tokenScope"
@@ -10,11 +10,21 @@ type ContentItem struct {
 	Thumbnail   string `json:"thumbnail"`
 	CreatedAt   string `json:"createdAt"`
 	Upvotes     int    `json:"upvotes"`
+	HasUpvoted  bool   `json:"hasUpvoted"`
+	CommentCount int   `json:"commentCount"`
+	ModerationStatus string `json:"moderationStatus,omitempty"`
 	User        User   `json:"user,omitempty"`
 	Tags        []Tag  `json:"tags,omitempty"`
 	Images      []Image `json:"images,omitempty"`
 }
 
+// UpvoteResponse represents the upvote state of a content item after a vote change
+type UpvoteResponse struct {
+	ContentID  int  `json:"contentId"`
+	Upvotes    int  `json:"upvotes"`
+	HasUpvoted bool `json:"hasUpvoted"`
+}
+
 // Pagination represents pagination metadata
 type Pagination struct {
 	CurrentPage  int `json:"currentPage"`
@@ -27,6 +37,8 @@ type Pagination struct {
 type ContentResponse struct {
 	Content    []ContentItem `json:"content"`
 	Pagination Pagination    `json:"pagination"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+	HasMore    bool          `json:"hasMore"`
 }
 
 // Tag represents a content tag
@@ -53,6 +65,24 @@ type CreateContentResponse struct {
 	CreatedAt string `json:"createdAt"`
 }
 
+// UpdateContentRequest edits content; fields left out keep their value
+type UpdateContentRequest struct {
+	Title        *string   `json:"title,omitempty"`
+	Description  *string   `json:"description,omitempty"`
+	ImageCount   *int      `json:"imageCount,omitempty"`
+	VideoCount   *int      `json:"videoCount,omitempty"`
+	ThumbnailURL *string   `json:"thumbnailUrl,omitempty"`
+	Tags         *[]string `json:"tags,omitempty"`
+	Images       *[]string `json:"images,omitempty"`
+}
+
+// UpdateContentResponse represents the response after content is edited
+type UpdateContentResponse struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
 // TradingContent represents a private content item for trading
 // (blurred until trade is accepted)
 type TradingContent struct {
@@ -120,4 +150,45 @@ type Image struct {
 	ID        int    `json:"id"`
 	ImageURL  string `json:"imageUrl"`
 	ImageOrder int   `json:"imageOrder"`
-}
\ No newline at end of file
+	// Variants are resized copies, narrowest first; empty until generated
+	Variants  []ImageVariant `json:"variants,omitempty"`
+	// SrcSet lists the variants in the format of the img srcset attribute
+	SrcSet    string `json:"srcset,omitempty"`
+}
+
+// ImageVariant is a resized JPEG copy of an uploaded image
+type ImageVariant struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Comment represents a comment on content, possibly a reply to another comment
+type Comment struct {
+	ID         int    `json:"id"`
+	ContentID  int    `json:"contentId"`
+	ParentID   *int   `json:"parentId,omitempty"`
+	User       User   `json:"user"`
+	Body       string `json:"body"`
+	IsDeleted  bool   `json:"isDeleted"`
+	ReplyCount int    `json:"replyCount"`
+	CreatedAt  string `json:"createdAt"`
+	UpdatedAt  string `json:"updatedAt"`
+}
+
+// CreateCommentRequest represents the request to comment on content or reply to a comment
+type CreateCommentRequest struct {
+	Body     string `json:"body"`
+	ParentID *int   `json:"parentId,omitempty"`
+}
+
+// UpdateCommentRequest represents the request to edit a comment
+type UpdateCommentRequest struct {
+	Body string `json:"body"`
+}
+
+// CommentResponse represents the API response for a page of comments
+type CommentResponse struct {
+	Comments   []Comment  `json:"comments"`
+	Pagination Pagination `json:"pagination"`
+}
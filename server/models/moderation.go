@@ -0,0 +1,42 @@
+package models
+
+// Report represents a user's report against a piece of content or another user's item
+type Report struct {
+	ID             int    `json:"id"`
+	ReporterID     int    `json:"reporterId"`
+	Reporter       string `json:"reporter,omitempty"`
+	TargetType     string `json:"targetType"` // content, trading_content, collection, message, comment
+	TargetID       int    `json:"targetId"`
+	Reason         string `json:"reason"`
+	Details        string `json:"details,omitempty"`
+	Status         string `json:"status"` // open, upheld, dismissed
+	ResolvedBy     *int   `json:"resolvedBy,omitempty"`
+	ResolvedAt     string `json:"resolvedAt,omitempty"`
+	ResolutionNote string `json:"resolutionNote,omitempty"`
+	CreatedAt      string `json:"createdAt"`
+}
+
+// CreateReportRequest represents the request to report an item
+type CreateReportRequest struct {
+	TargetType string `json:"targetType"`
+	TargetID   int    `json:"targetId"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details,omitempty"`
+}
+
+// ResolveReportRequest represents a moderator's decision on a report
+type ResolveReportRequest struct {
+	Action string `json:"action"` // uphold, dismiss
+	Note   string `json:"note,omitempty"`
+}
+
+// UpdateModerationStatusRequest represents a moderator setting the moderation state of content
+type UpdateModerationStatusRequest struct {
+	Status string `json:"status"` // approved, pending, removed
+}
+
+// ReportResponse represents the API response for report listings
+type ReportResponse struct {
+	Reports    []Report   `json:"reports"`
+	Pagination Pagination `json:"pagination"`
+}
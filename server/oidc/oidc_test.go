@@ -0,0 +1,253 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testProvider serves a JWKS with one RSA and one ECDSA key, plus discovery
+// and a token endpoint that returns idToken
+type testProvider struct {
+	server   *httptest.Server
+	rsaKey   *rsa.PrivateKey
+	ecKey    *ecdsa.PrivateKey
+	idToken  string
+	lastForm map[string]string
+}
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := &testProvider{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tp.document())
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]jwk{"keys": {
+			{Kty: "RSA", Kid: "rsa-1", Use: "sig", N: encodeBigInt(rsaKey.N), E: encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+			{Kty: "EC", Kid: "ec-1", Crv: "P-256", X: encodeBigInt(ecKey.X), Y: encodeBigInt(ecKey.Y)},
+			{Kty: "RSA", Kid: "enc-1", Use: "enc", N: encodeBigInt(rsaKey.N), E: "AQAB"},
+			{Kty: "OKP", Kid: "okp-1", Crv: "Ed25519", X: "AAAA"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		tp.lastForm = map[string]string{}
+		for name := range r.PostForm {
+			tp.lastForm[name] = r.PostForm.Get(name)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": tp.idToken})
+	})
+	tp.server = httptest.NewServer(mux)
+	t.Cleanup(tp.server.Close)
+	return tp
+}
+
+func (tp *testProvider) document() *discoveryDocument {
+	return &discoveryDocument{
+		Issuer:                tp.server.URL,
+		AuthorizationEndpoint: tp.server.URL + "/authorize",
+		TokenEndpoint:         tp.server.URL + "/token",
+		JWKSURI:               tp.server.URL + "/jwks",
+	}
+}
+
+// claims returns valid ID token claims for the test client
+func (tp *testProvider) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            tp.server.URL,
+		"aud":            "test-client",
+		"sub":            "user-123",
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "test-nonce",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane",
+	}
+}
+
+func (tp *testProvider) sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	var key interface{} = tp.rsaKey
+	switch method.Alg() {
+	case "ES256":
+		key = tp.ecKey
+	case "HS256":
+		key = []byte("shared secret")
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	tp := newTestProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  func() string
+		wantOK bool
+	}{
+		{"RS256", func() string { return tp.sign(t, jwt.SigningMethodRS256, "rsa-1", tp.claims()) }, true},
+		{"ES256", func() string { return tp.sign(t, jwt.SigningMethodES256, "ec-1", tp.claims()) }, true},
+		{"string email_verified", func() string {
+			c := tp.claims()
+			c["email_verified"] = "true"
+			return tp.sign(t, jwt.SigningMethodRS256, "rsa-1", c)
+		}, true},
+		{"wrong nonce", func() string {
+			c := tp.claims()
+			c["nonce"] = "other"
+			return tp.sign(t, jwt.SigningMethodRS256, "rsa-1", c)
+		}, false},
+		{"wrong audience", func() string {
+			c := tp.claims()
+			c["aud"] = "other-client"
+			return tp.sign(t, jwt.SigningMethodRS256, "rsa-1", c)
+		}, false},
+		{"wrong issuer", func() string {
+			c := tp.claims()
+			c["iss"] = "https://evil.example.com"
+			return tp.sign(t, jwt.SigningMethodRS256, "rsa-1", c)
+		}, false},
+		{"expired", func() string {
+			c := tp.claims()
+			c["exp"] = time.Now().Add(-5 * time.Minute).Unix()
+			return tp.sign(t, jwt.SigningMethodRS256, "rsa-1", c)
+		}, false},
+		{"no expiry", func() string {
+			c := tp.claims()
+			delete(c, "exp")
+			return tp.sign(t, jwt.SigningMethodRS256, "rsa-1", c)
+		}, false},
+		{"no subject", func() string {
+			c := tp.claims()
+			delete(c, "sub")
+			return tp.sign(t, jwt.SigningMethodRS256, "rsa-1", c)
+		}, false},
+		{"unknown kid", func() string { return tp.sign(t, jwt.SigningMethodRS256, "rsa-2", tp.claims()) }, false},
+		{"encryption key", func() string { return tp.sign(t, jwt.SigningMethodRS256, "enc-1", tp.claims()) }, false},
+		{"ambiguous missing kid", func() string { return tp.sign(t, jwt.SigningMethodRS256, "", tp.claims()) }, false},
+		{"HS256", func() string { return tp.sign(t, jwt.SigningMethodHS256, "rsa-1", tp.claims()) }, false},
+		{"forged signature", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, tp.claims())
+			token.Header["kid"] = "rsa-1"
+			signed, _ := token.SignedString(otherKey)
+			return signed
+		}, false},
+		{"garbage", func() string { return "not.a.token" }, false},
+	}
+
+	p := &Provider{Name: "test", Issuer: tp.server.URL, ClientID: "test-client"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := p.verifyIDToken(context.Background(), tp.document(), tt.token(), "test-nonce")
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("verifyIDToken() error = %v, want ok %v", err, tt.wantOK)
+			}
+			if err != nil {
+				return
+			}
+			if identity.Subject != "user-123" || identity.Email != "jane@example.com" || !identity.EmailVerified || identity.Name != "Jane" {
+				t.Errorf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tp := newTestProvider(t)
+	tp.idToken = tp.sign(t, jwt.SigningMethodRS256, "rsa-1", tp.claims())
+	p := &Provider{
+		Name:         "test",
+		Issuer:       tp.server.URL,
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+		RedirectURL:  "https://app.example.com/api/auth/oidc/test/callback",
+		Scopes:       []string{"openid", "email"},
+	}
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "test-state", "test-nonce", "test-verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	for _, want := range []string{
+		tp.server.URL + "/authorize?",
+		"code_challenge=" + CodeChallenge("test-verifier"),
+		"code_challenge_method=S256",
+		"state=test-state",
+		"scope=openid+email",
+	} {
+		if !strings.Contains(authURL, want) {
+			t.Errorf("AuthCodeURL() = %s, missing %s", authURL, want)
+		}
+	}
+
+	identity, err := p.Exchange(ctx, "test-code", "test-verifier", "test-nonce")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Subject != "user-123" {
+		t.Errorf("Subject = %s, want user-123", identity.Subject)
+	}
+	for name, want := range map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          "test-code",
+		"code_verifier": "test-verifier",
+		"client_secret": "test-secret",
+		"redirect_uri":  p.RedirectURL,
+	} {
+		if got := tp.lastForm[name]; got != want {
+			t.Errorf("token request %s = %q, want %q", name, got, want)
+		}
+	}
+
+	if _, err := p.Exchange(ctx, "test-code", "test-verifier", "other-nonce"); err == nil {
+		t.Error("Exchange accepted an ID token with the wrong nonce")
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	if got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("CodeChallenge() = %s", got)
+	}
+}
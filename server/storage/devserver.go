@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DevServer is a minimal S3-compatible object store for development and for
+// trying the s3 driver without a real bucket. It supports PUT, GET, HEAD and
+// DELETE on /<bucket>/<key> (path-style), checks Signature Version 4 request
+// signatures and keeps objects as files under a directory. Never expose it publicly.
+type DevServer struct {
+	Bucket string
+	store  *Local
+	signer signer
+}
+
+// NewDevServer returns a stand-in object store keeping bucket's objects in dir
+func NewDevServer(dir, bucket, accessKey, secretKey, region string) (*DevServer, error) {
+	store, err := NewLocal(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &DevServer{
+		Bucket: bucket,
+		store:  store,
+		signer: signer{accessKey: accessKey, secretKey: secretKey, region: region, service: "s3"},
+	}, nil
+}
+
+// ServeHTTP handles a single object request
+func (d *DevServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := d.signer.verify(r, time.Now()); err != nil {
+		devS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != d.Bucket {
+		devS3Error(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	if !ValidKey(key) {
+		devS3Error(w, http.StatusBadRequest, "InvalidArgument", "Invalid object key")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			devS3Error(w, http.StatusLengthRequired, "MissingContentLength", "Content-Length is required")
+			return
+		}
+		if err := d.store.Put(r.Context(), key, r.Body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+			devS3Error(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		body, info, err := d.store.Get(r.Context(), key)
+		if errors.Is(err, ErrNotFound) {
+			devS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+			return
+		}
+		if err != nil {
+			devS3Error(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		defer body.Close()
+		w.Header().Set("Content-Type", info.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			io.Copy(w, body)
+		}
+	case http.MethodDelete:
+		if err := d.store.Delete(r.Context(), key); err != nil {
+			devS3Error(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		devS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	}
+}
+
+// devS3Error writes an error in the XML shape S3 uses
+func devS3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, strings.ReplaceAll(message, "<", "&lt;"))
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocal(filepath.Join(t.TempDir(), "uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(ctx, "messages/clip.txt", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	body, info, err := store.Get(ctx, "messages/clip.txt")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "hello" {
+		t.Errorf("Get read %q, want %q", data, "hello")
+	}
+	if info.Size != 5 || !strings.HasPrefix(info.ContentType, "text/plain") {
+		t.Errorf("Get info = %+v, want 5 bytes of text/plain", info)
+	}
+	if _, ok := body.(io.Seeker); !ok {
+		t.Error("Get reader does not support seeking")
+	}
+
+	if info, err := store.Stat(ctx, "messages/clip.txt"); err != nil || info.Size != 5 {
+		t.Errorf("Stat = %+v, %v, want 5 bytes", info, err)
+	}
+	if got := store.URL("messages/clip.txt"); got != "/uploads/messages/clip.txt" {
+		t.Errorf("URL = %s, want /uploads/messages/clip.txt", got)
+	}
+
+	if err := store.Delete(ctx, "messages/clip.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := store.Get(ctx, "messages/clip.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Stat(ctx, "messages"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a directory error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "missing.txt"); err != nil {
+		t.Errorf("Delete of a missing object = %v, want nil", err)
+	}
+}
+
+func TestLocalPutSizeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(context.Background(), "short.txt", strings.NewReader("abc"), 10, ""); err == nil {
+		t.Error("Put with a short body succeeded")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Put left %d files behind", len(entries))
+	}
+}
+
+func TestLocalRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"../escape.txt", "/etc/passwd", "a/../../b", ""} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrNotFound", key, err)
+		}
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	tests := map[string]bool{
+		"photo_123.jpg":         true,
+		"messages/clip_456.mp4": true,
+		"variants/a_320w.jpg":   true,
+		"":                      false,
+		".":                     false,
+		"..":                    false,
+		"../a":                  false,
+		"/a":                    false,
+		"a/./b":                 false,
+		"a//b":                  false,
+		"a\\b":                  false,
+		"a/":                    false,
+	}
+	for key, want := range tests {
+		if got := ValidKey(key); got != want {
+			t.Errorf("ValidKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 stores objects in a bucket of an S3-compatible object store (AWS S3,
+// MinIO, Cloudflare R2, ...), signing requests with Signature Version 4
+type S3 struct {
+	Endpoint string // scheme://host[:port]
+	Region   string
+	Bucket   string
+	// Prefix is prepended to every key, e.g. "uploads/"
+	Prefix string
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of bucket.endpoint/key
+	PathStyle bool
+	// PublicURL, when set, is where clients fetch objects directly; otherwise
+	// the API serves them under /uploads/
+	PublicURL string
+
+	signer signer
+	client *http.Client
+}
+
+// NewS3FromEnv configures S3 storage from S3_BUCKET, S3_ACCESS_KEY_ID,
+// S3_SECRET_ACCESS_KEY and optionally S3_REGION (default us-east-1),
+// S3_ENDPOINT (default AWS), S3_PATH_STYLE, S3_PREFIX and S3_PUBLIC_URL.
+// Custom endpoints use path-style addressing unless S3_PATH_STYLE=false.
+func NewS3FromEnv() (*S3, error) {
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	s := &S3{
+		Endpoint:  strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+		Region:    region,
+		Bucket:    os.Getenv("S3_BUCKET"),
+		Prefix:    os.Getenv("S3_PREFIX"),
+		PublicURL: strings.TrimRight(os.Getenv("S3_PUBLIC_URL"), "/"),
+		signer: signer{
+			accessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			secretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			region:    region,
+			service:   "s3",
+		},
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+	if s.Bucket == "" || s.signer.accessKey == "" || s.signer.secretKey == "" {
+		return nil, errors.New("STORAGE_DRIVER=s3 requires S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = "https://s3." + region + ".amazonaws.com"
+	} else {
+		s.PathStyle = true
+	}
+	if v := os.Getenv("S3_PATH_STYLE"); v != "" {
+		s.PathStyle = v == "true"
+	}
+	if _, err := url.Parse(s.Endpoint); err != nil {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT: %v", err)
+	}
+	return s, nil
+}
+
+// objectURL is the store address of a key
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if s.PathStyle {
+		u.Path = "/" + s.Bucket + "/" + s.Prefix + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + s.Prefix + key
+	}
+	// Send the path encoded exactly as it is signed
+	u.RawPath = uriEncode(u.Path, false)
+	return u, nil
+}
+
+// do sends a signed request for a key
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	if !ValidKey(key) {
+		return nil, fmt.Errorf("invalid storage key %q", key)
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		req.ContentLength = size
+		payloadHash = unsignedPayload
+	}
+	s.signer.sign(req, payloadHash, time.Now())
+	return s.client.Do(req)
+}
+
+// Put uploads the object
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if size < 0 {
+		return errors.New("S3 uploads need a known size")
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	// Keep the transport from closing a file the caller still owns
+	resp, err := s.do(ctx, http.MethodPut, key, io.NopCloser(r), size, header)
+	if err != nil {
+		return fmt.Errorf("S3 put %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("put", key, resp)
+	}
+	return nil
+}
+
+// Get downloads the object; the body is streamed from the store
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("S3 get %s: %v", key, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, s3Error("get", key, resp)
+	}
+	return resp.Body, objectInfo(key, resp), nil
+}
+
+// Delete removes the object
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, nil)
+	if err != nil {
+		return fmt.Errorf("S3 delete %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error("delete", key, resp)
+	}
+	return nil
+}
+
+// Stat describes the object with a HEAD request
+func (s *S3) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("S3 stat %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error("stat", key, resp)
+	}
+	return objectInfo(key, resp), nil
+}
+
+// URL returns PublicURL/key when objects are public, otherwise the API path
+// that proxies them
+func (s *S3) URL(key string) string {
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + s.Prefix + key
+	}
+	return UploadsPath + key
+}
+
+// objectInfo reads object metadata from response headers
+func objectInfo(key string, resp *http.Response) *ObjectInfo {
+	info := &ObjectInfo{Key: key, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info
+}
+
+// s3Error turns an unexpected response into an error including the store's message
+func s3Error(op, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 %s %s: %s: %s", op, key, resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestS3 starts a DevServer and returns S3 storage pointing at it, signing
+// with secretKey
+func newTestS3(t *testing.T, secretKey string) *S3 {
+	t.Helper()
+	dev, err := NewDevServer(t.TempDir(), "test-bucket", "test-access", "test-secret", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(dev)
+	t.Cleanup(server.Close)
+
+	t.Setenv("STORAGE_DRIVER", "s3")
+	t.Setenv("S3_ENDPOINT", server.URL)
+	t.Setenv("S3_BUCKET", "test-bucket")
+	t.Setenv("S3_ACCESS_KEY_ID", "test-access")
+	t.Setenv("S3_SECRET_ACCESS_KEY", secretKey)
+	t.Setenv("S3_PREFIX", "uploads/")
+	s3, err := NewS3FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3
+}
+
+func TestS3DevServerRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s3 := newTestS3(t, "test-secret")
+	if !s3.PathStyle {
+		t.Error("custom endpoints should use path-style addressing")
+	}
+
+	key := "messages/a clip+1.mp4"
+	if err := s3.Put(ctx, key, strings.NewReader("video bytes"), 11, "video/mp4"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	body, info, err := s3.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "video bytes" {
+		t.Errorf("Get read %q, want %q", data, "video bytes")
+	}
+	if info.Size != 11 || info.ContentType != "video/mp4" || info.ModTime.IsZero() {
+		t.Errorf("Get info = %+v, want 11 bytes of video/mp4 with a modification time", info)
+	}
+
+	if info, err := s3.Stat(ctx, key); err != nil || info.Size != 11 {
+		t.Errorf("Stat = %+v, %v, want 11 bytes", info, err)
+	}
+
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := s3.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := s3.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3DevServerRejectsBadSignature(t *testing.T) {
+	s3 := newTestS3(t, "wrong-secret")
+	err := s3.Put(context.Background(), "a.txt", strings.NewReader("x"), 1, "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put error = %v, want SignatureDoesNotMatch", err)
+	}
+}
+
+func TestDevServerRejectsUnsignedRequests(t *testing.T) {
+	dev, err := NewDevServer(t.TempDir(), "test-bucket", "test-access", "test-secret", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	dev.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test-bucket/a.txt", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("unsigned GET status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestS3URL(t *testing.T) {
+	s3 := &S3{Prefix: "uploads/"}
+	if got := s3.URL("a.jpg"); got != "/uploads/a.jpg" {
+		t.Errorf("URL without PublicURL = %s, want /uploads/a.jpg", got)
+	}
+	s3.PublicURL = "https://cdn.example.com"
+	if got := s3.URL("a.jpg"); got != "https://cdn.example.com/uploads/a.jpg" {
+		t.Errorf("URL = %s, want https://cdn.example.com/uploads/a.jpg", got)
+	}
+}
@@ -0,0 +1,106 @@
+// Package storage keeps uploaded files on local disk or in an S3-compatible
+// object store behind one interface.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"project/server/utils"
+)
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage stores files by key, a relative slash-separated path such as
+// "photo_123.jpg" or "messages/clip_456.mp4"
+type Storage interface {
+	// Put stores size bytes from r under key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens an object; the caller closes the reader. Readers that also
+	// implement io.Seeker support range requests when served.
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// Delete removes an object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// Stat describes an object without reading it
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// URL returns the address clients fetch the object from
+	URL(key string) string
+}
+
+// UploadsPath is where the API serves stored files; URLs saved before the
+// storage backends existed use it too
+const UploadsPath = "/uploads/"
+
+// Default is the storage used by the handlers. Init replaces it based on the environment.
+var Default Storage
+
+// Init selects the storage backend from the environment. STORAGE_DRIVER is
+// "local" (the default) or "s3"; see NewLocal and NewS3FromEnv for their settings.
+func Init() error {
+	switch driver := strings.ToLower(os.Getenv("STORAGE_DRIVER")); driver {
+	case "", "local":
+		dir := os.Getenv("UPLOADS_DIR")
+		if dir == "" {
+			dir = utils.GetUploadsDir()
+		}
+		local, err := NewLocal(dir)
+		if err != nil {
+			return err
+		}
+		log.Printf("Storing uploads on local disk in %s", dir)
+		Default = local
+	case "s3":
+		s3, err := NewS3FromEnv()
+		if err != nil {
+			return err
+		}
+		log.Printf("Storing uploads in bucket %s at %s", s3.Bucket, s3.Endpoint)
+		Default = s3
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q (use local or s3)", driver)
+	}
+	return nil
+}
+
+// ValidKey reports whether key is a clean relative path that stays inside the
+// storage root
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	if path.Clean(key) != key {
+		return false
+	}
+	return key != "." && key != ".." && !strings.HasPrefix(key, "../")
+}
+
+// KeyFromURL returns the key of a URL produced by the Default storage or
+// served under /uploads/, and false for URLs pointing anywhere else
+func KeyFromURL(url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, UploadsPath)
+	if !ok && Default != nil {
+		if base := Default.URL(""); base != UploadsPath {
+			key, ok = strings.CutPrefix(url, base)
+		}
+	}
+	if !ok || !ValidKey(key) {
+		return "", false
+	}
+	return key, true
+}
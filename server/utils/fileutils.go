@@ -3,7 +3,6 @@ package utils
 import (
 	"log"
 	"os"
-	"path/filepath"
 )
 
 // GetUploadsDir returns the appropriate uploads directory path
@@ -31,30 +30,3 @@ func GetUploadsDir() string {
 	log.Printf("Using local uploads directory: %s", localDir)
 	return localDir
 }
-
-// EnsureUploadsDir creates the uploads directory and returns the path
-func EnsureUploadsDir() (string, error) {
-	uploadDir := GetUploadsDir()
-	
-	// Create the directory if it doesn't exist
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		return "", err
-	}
-	
-	// Test if the directory is writable
-	testFile := filepath.Join(uploadDir, ".test")
-	if f, err := os.Create(testFile); err != nil {
-		return "", err
-	} else {
-		f.Close()
-		os.Remove(testFile) // Clean up test file
-	}
-	
-	return uploadDir, nil
-}
-
-// IsPersistentStorage checks if the current storage is persistent
-func IsPersistentStorage() bool {
-	uploadDir := GetUploadsDir()
-	return uploadDir == "/tmp/uploads"
-} 
\ No newline at end of file
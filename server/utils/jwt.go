@@ -2,7 +2,6 @@ package utils
 
 import (
 	"fmt"
-	"os"
 	"time"
 
 	"project/server/models"
@@ -10,40 +9,49 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AccessTokenTTL is how long an access token is valid; clients renew it with a refresh token
+const AccessTokenTTL = 15 * time.Minute
+
 // CustomClaims represents the claims in the JWT
 type CustomClaims struct {
 	UserID   int    `json:"userId"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	Role     string `json:"role,omitempty"`
+	// SessionID is the login session the token was issued for
+	SessionID int `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateJWT creates a new JWT token for a user
-func GenerateJWT(user models.User) (string, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		secretKey = "my-secret-key" // Default for development only
+// GenerateJWT creates a new short-lived access token for a user's session
+func GenerateJWT(user models.User, sessionID int) (string, error) {
+	// Tokens are signed with the newest key of the key ring
+	ring, err := jwtKeys()
+	if err != nil {
+		return "", err
 	}
 
 	// Create claims with user data
 	claims := CustomClaims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token expires in 24 hours
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "arouzy-api",
 		},
 	}
 
-	// Create the token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Create the token, naming the key so validation can pick it from the ring
+	token := jwt.NewWithClaims(ring.current.method, claims)
+	token.Header["kid"] = ring.current.id
 
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString([]byte(secretKey))
+	// Sign the token with the current key
+	tokenString, err := token.SignedString(ring.current.signKey)
 	if err != nil {
 		return "", err
 	}
@@ -53,20 +61,13 @@ func GenerateJWT(user models.User) (string, error) {
 
 // ValidateJWT validates a JWT token and returns the claims
 func ValidateJWT(tokenString string) (*CustomClaims, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		secretKey = "my-secret-key" // Default for development only
+	ring, err := jwtKeys()
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse and validate the token
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secretKey), nil
-	})
+	// Parse and validate the token with the key named by its kid
+	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, ring.keyFunc)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,360 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultJWTSecret is used when JWT_SECRET is unset, for development only
+const defaultJWTSecret = "my-secret-key"
+
+// jwtKey is one key of the JWT key ring
+type jwtKey struct {
+	id     string
+	method jwt.SigningMethod
+	// signKey is nil for keys that are only kept to validate older tokens
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// jwtKeyRing holds the key new access tokens are signed with and every key
+// whose tokens are still accepted, by kid
+type jwtKeyRing struct {
+	current *jwtKey
+	keys    map[string]*jwtKey
+	// legacy validates tokens issued before tokens carried a kid. It is only
+	// set while JWT_SECRET is the sole key; once keys are rotated every token
+	// must name its key.
+	legacy *jwtKey
+}
+
+// JWK is a public key as published in the JWKS document (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+var (
+	keyRingMu sync.Mutex
+	keyRing   *jwtKeyRing
+)
+
+// IsDevelopment reports whether the server runs in development, the only
+// place the default secret is allowed: APP_ENV=development, or no APP_ENV
+// outside Railway, which sets RAILWAY_* variables in every deployment. Any
+// other APP_ENV counts as a deployment.
+func IsDevelopment() bool {
+	if env := os.Getenv("APP_ENV"); env != "" {
+		return strings.EqualFold(env, "development")
+	}
+	for _, variable := range os.Environ() {
+		if strings.HasPrefix(variable, "RAILWAY_") {
+			return false
+		}
+	}
+	return true
+}
+
+// configuredSecret returns the first of the named environment variables that
+// is set. Outside development it fails when none is, or when the value is the
+// development default; in development it falls back to that default.
+func configuredSecret(names ...string) (string, error) {
+	for _, name := range names {
+		if secret := os.Getenv(name); secret != "" {
+			if secret == defaultJWTSecret && !IsDevelopment() {
+				return "", fmt.Errorf("%s must not be the development default outside development", name)
+			}
+			return secret, nil
+		}
+	}
+	if !IsDevelopment() {
+		return "", fmt.Errorf("%s must be set to a strong random value (set APP_ENV=development to use the default)",
+			strings.Join(names, " or "))
+	}
+	return defaultJWTSecret, nil
+}
+
+// LoadJWTKeys builds the JWT key ring from the environment:
+//
+//   - JWT_SECRET signs HS256 tokens and JWT_PREVIOUS_SECRETS (comma-separated)
+//     lists retired secrets whose tokens are still accepted
+//   - JWT_SIGNING_ALG set to EdDSA or RS256 signs with the PEM private key in
+//     JWT_PRIVATE_KEY or the file named by JWT_PRIVATE_KEY_FILE, and
+//     JWT_PREVIOUS_PUBLIC_KEYS_FILE holds PEM public keys of retired key pairs.
+//     JWT_SECRET is then not accepted for access tokens unless it is listed in
+//     JWT_PREVIOUS_SECRETS, and not needed when TOKEN_SIGNING_SECRET is set.
+//
+// Outside development (see IsDevelopment) it refuses to run without real
+// secrets for access tokens and signed tokens.
+func LoadJWTKeys() error {
+	ring, err := loadJWTKeyRing()
+	if err != nil {
+		return err
+	}
+	keyRingMu.Lock()
+	keyRing = ring
+	keyRingMu.Unlock()
+	return nil
+}
+
+// jwtKeys returns the key ring, loading it on first use
+func jwtKeys() (*jwtKeyRing, error) {
+	keyRingMu.Lock()
+	defer keyRingMu.Unlock()
+	if keyRing == nil {
+		ring, err := loadJWTKeyRing()
+		if err != nil {
+			return nil, err
+		}
+		keyRing = ring
+	}
+	return keyRing, nil
+}
+
+// loadJWTKeyRing reads the key ring configuration described at LoadJWTKeys
+func loadJWTKeyRing() (*jwtKeyRing, error) {
+	// Signed tokens fall back to JWT_SECRET, so check them here too
+	if _, err := signedTokenSecret(); err != nil {
+		return nil, err
+	}
+
+	ring := &jwtKeyRing{keys: map[string]*jwtKey{}}
+	for _, previous := range strings.Split(os.Getenv("JWT_PREVIOUS_SECRETS"), ",") {
+		if previous = strings.TrimSpace(previous); previous != "" {
+			ring.add(hmacKey(previous))
+		}
+	}
+
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	switch strings.ToUpper(alg) {
+	case "", "HS256":
+		secret, err := configuredSecret("JWT_SECRET")
+		if err != nil {
+			return nil, err
+		}
+		ring.current = hmacKey(secret)
+		ring.add(ring.current)
+	case "EDDSA", "RS256":
+		pemData := []byte(os.Getenv("JWT_PRIVATE_KEY"))
+		if len(pemData) == 0 {
+			path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+			if path == "" {
+				return nil, fmt.Errorf("JWT_SIGNING_ALG=%s requires JWT_PRIVATE_KEY or JWT_PRIVATE_KEY_FILE", alg)
+			}
+			var err error
+			if pemData, err = os.ReadFile(path); err != nil {
+				return nil, fmt.Errorf("error reading JWT private key: %v", err)
+			}
+		}
+		key, err := parsePrivateKey(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT private key: %v", err)
+		}
+		if !strings.EqualFold(key.method.Alg(), alg) {
+			return nil, fmt.Errorf("JWT private key is not a %s key", alg)
+		}
+		ring.current = key
+		ring.add(key)
+	default:
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG %q (use HS256, EdDSA or RS256)", alg)
+	}
+
+	if path := os.Getenv("JWT_PREVIOUS_PUBLIC_KEYS_FILE"); path != "" {
+		pemData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading previous JWT public keys: %v", err)
+		}
+		keys, err := parsePublicKeys(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous JWT public key: %v", err)
+		}
+		for _, key := range keys {
+			ring.add(key)
+		}
+	}
+
+	// Tokens without a kid predate the key ring, so they are only accepted
+	// while nothing has been rotated
+	if len(ring.keys) == 1 && ring.current.method == jwt.SigningMethodHS256 {
+		ring.legacy = ring.current
+	}
+
+	return ring, nil
+}
+
+// add registers a key for validation; the first key with an ID wins
+func (ring *jwtKeyRing) add(key *jwtKey) {
+	if _, exists := ring.keys[key.id]; !exists {
+		ring.keys[key.id] = key
+	}
+}
+
+// keyFunc picks the validation key for a token by its kid header
+func (ring *jwtKeyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := ring.legacy
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = ring.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+	if key == nil {
+		return nil, errors.New("token does not name its signing key")
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// hmacKey returns an HS256 key. Its kid is derived from a hash of the secret
+// so it is stable across restarts and instances without revealing the secret.
+func hmacKey(secret string) *jwtKey {
+	sum := sha256.Sum256([]byte("jwt-kid:" + secret))
+	return &jwtKey{
+		id:        "hs-" + hex.EncodeToString(sum[:6]),
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// parsePrivateKey reads an Ed25519 or RSA private key in PKCS#8 or PKCS#1 PEM
+func parsePrivateKey(pemData []byte) (*jwtKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	key, err := publicJWTKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.signKey = parsed
+	return key, nil
+}
+
+// parsePublicKeys reads every PKIX public key (or private key, whose public
+// half is used) in a PEM bundle
+func parsePublicKeys(pemData []byte) ([]*jwtKey, error) {
+	var keys []*jwtKey
+	for {
+		block, rest := pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		pemData = rest
+
+		var key *jwtKey
+		var err error
+		if block.Type == "PUBLIC KEY" {
+			var pub interface{}
+			if pub, err = x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+				key, err = publicJWTKey(pub)
+			}
+		} else {
+			key, err = parsePrivateKey(pem.EncodeToMemory(block))
+			if key != nil {
+				key.signKey = nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// publicJWTKey wraps an Ed25519 or RSA public key; its kid is derived from
+// the key's DER encoding
+func publicJWTKey(pub interface{}) (*jwtKey, error) {
+	var method jwt.SigningMethod
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return &jwtKey{
+		id:        base64.RawURLEncoding.EncodeToString(sum[:12]),
+		method:    method,
+		verifyKey: pub,
+	}, nil
+}
+
+// PublicJWKs returns the public keys that validate access tokens, for the
+// JWKS endpoint. HMAC secrets are never published, so with HS256 signing the
+// set only holds retired asymmetric keys, if any.
+func PublicJWKs() ([]JWK, error) {
+	ring, err := jwtKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := []JWK{}
+	add := func(key *jwtKey) {
+		switch pub := key.verifyKey.(type) {
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{Kty: "OKP", Kid: key.id, Use: "sig", Alg: key.method.Alg(), Crv: "Ed25519",
+				X: base64.RawURLEncoding.EncodeToString(pub)})
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{Kty: "RSA", Kid: key.id, Use: "sig", Alg: key.method.Alg(),
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())})
+		}
+	}
+	// List the current key first, then retired ones
+	add(ring.current)
+	for id, key := range ring.keys {
+		if id != ring.current.id {
+			add(key)
+		}
+	}
+	return jwks, nil
+}
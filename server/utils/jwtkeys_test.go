@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"project/server/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyEnv is every variable that configures the key ring
+var keyEnv = []string{
+	"APP_ENV", "JWT_SECRET", "JWT_PREVIOUS_SECRETS", "JWT_SIGNING_ALG", "JWT_PRIVATE_KEY",
+	"JWT_PRIVATE_KEY_FILE", "JWT_PREVIOUS_PUBLIC_KEYS_FILE", "TOKEN_SIGNING_SECRET",
+}
+
+// setKeyEnv clears the key ring configuration and any Railway variables,
+// then applies env
+func setKeyEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, name := range keyEnv {
+		t.Setenv(name, "")
+	}
+	for _, variable := range os.Environ() {
+		if name, _, _ := strings.Cut(variable, "="); strings.HasPrefix(name, "RAILWAY_") {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+}
+
+// loadKeys applies env and loads the key ring
+func loadKeys(t *testing.T, env map[string]string) {
+	t.Helper()
+	setKeyEnv(t, env)
+	if err := LoadJWTKeys(); err != nil {
+		t.Fatalf("LoadJWTKeys: %v", err)
+	}
+}
+
+// ed25519PEM returns a new Ed25519 private key as PKCS#8 PEM
+func ed25519PEM(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), priv
+}
+
+// signTestToken signs access token claims with key, naming kid when it is set
+func signTestToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, CustomClaims{
+		UserID: 7,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestLoadJWTKeysRequiresSecretsOutsideDevelopment(t *testing.T) {
+	privatePEM, _ := ed25519PEM(t)
+	tests := []struct {
+		name string
+		env  map[string]string
+		ok   bool
+	}{
+		{"development without secrets", map[string]string{}, true},
+		{"explicit development on Railway", map[string]string{"APP_ENV": "development", "RAILWAY_ENVIRONMENT": "production"}, true},
+		{"Railway without secrets", map[string]string{"RAILWAY_STATIC_URL": "api.up.railway.app"}, false},
+		{"Railway with the default secret", map[string]string{"RAILWAY_ENVIRONMENT": "production", "JWT_SECRET": defaultJWTSecret}, false},
+		{"Railway with a secret", map[string]string{"RAILWAY_ENVIRONMENT": "production", "JWT_SECRET": "strong"}, true},
+		{"production without secrets", map[string]string{"APP_ENV": "production"}, false},
+		{"staging without secrets", map[string]string{"APP_ENV": "staging"}, false},
+		{"default signed token secret", map[string]string{"APP_ENV": "production", "JWT_SECRET": "strong", "TOKEN_SIGNING_SECRET": defaultJWTSecret}, false},
+		{"EdDSA with a token secret", map[string]string{
+			"APP_ENV": "production", "JWT_SIGNING_ALG": "EdDSA", "JWT_PRIVATE_KEY": privatePEM, "TOKEN_SIGNING_SECRET": "strong",
+		}, true},
+		{"EdDSA without a token secret", map[string]string{
+			"APP_ENV": "production", "JWT_SIGNING_ALG": "EdDSA", "JWT_PRIVATE_KEY": privatePEM,
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setKeyEnv(t, tt.env)
+			if err := LoadJWTKeys(); (err == nil) != tt.ok {
+				t.Errorf("LoadJWTKeys() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSignTokenRequiresSecretOutsideDevelopment(t *testing.T) {
+	setKeyEnv(t, map[string]string{"APP_ENV": "production"})
+	if _, err := SignToken("test", 1, time.Minute); err == nil {
+		t.Error("SignToken signed with the default secret in production")
+	}
+
+	setKeyEnv(t, map[string]string{"APP_ENV": "production", "TOKEN_SIGNING_SECRET": "strong"})
+	token, err := SignToken("test", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("SignToken: %v", err)
+	}
+	t.Setenv("TOKEN_SIGNING_SECRET", "other")
+	var data int
+	if err := VerifySignedToken("test", token, &data); err == nil {
+		t.Error("token verified with a different secret")
+	}
+}
+
+func TestKeyRingHS256(t *testing.T) {
+	loadKeys(t, map[string]string{"JWT_SECRET": "secret-a"})
+	keyA := hmacKey("secret-a")
+
+	token, err := GenerateJWT(models.User{ID: 7}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &CustomClaims{})
+	if err != nil || parsed.Header["kid"] != keyA.id {
+		t.Errorf("kid = %v, want %s", parsed.Header["kid"], keyA.id)
+	}
+	if claims, err := ValidateJWT(token); err != nil || claims.UserID != 7 {
+		t.Errorf("ValidateJWT() = %+v, %v", claims, err)
+	}
+
+	// Tokens from before the key ring carry no kid
+	legacy := signTestToken(t, jwt.SigningMethodHS256, []byte("secret-a"), "")
+	if _, err := ValidateJWT(legacy); err != nil {
+		t.Errorf("token without kid rejected while JWT_SECRET is the only key: %v", err)
+	}
+	if _, err := ValidateJWT(signTestToken(t, jwt.SigningMethodHS256, []byte("secret-a"), "hs-unknown")); err == nil {
+		t.Error("token naming an unknown kid accepted")
+	}
+	if _, err := ValidateJWT(signTestToken(t, jwt.SigningMethodHS256, []byte("secret-b"), keyA.id)); err == nil {
+		t.Error("token signed with another secret accepted")
+	}
+
+	// After rotation the old secret still validates its tokens by kid, but
+	// tokens without a kid are no longer accepted
+	loadKeys(t, map[string]string{"JWT_SECRET": "secret-b", "JWT_PREVIOUS_SECRETS": "secret-a"})
+	if _, err := ValidateJWT(token); err != nil {
+		t.Errorf("token signed with the previous secret rejected: %v", err)
+	}
+	if _, err := ValidateJWT(legacy); err == nil {
+		t.Error("token without kid accepted after rotation")
+	}
+	rotated, err := GenerateJWT(models.User{ID: 7}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, _ = jwt.NewParser().ParseUnverified(rotated, &CustomClaims{})
+	if parsed.Header["kid"] != hmacKey("secret-b").id {
+		t.Errorf("new tokens use kid %v, want the current secret's", parsed.Header["kid"])
+	}
+
+	// Retired secrets that are no longer listed stop working
+	loadKeys(t, map[string]string{"JWT_SECRET": "secret-b"})
+	if _, err := ValidateJWT(token); err == nil {
+		t.Error("token signed with a dropped secret accepted")
+	}
+}
+
+func TestKeyRingEdDSA(t *testing.T) {
+	oldPEM, oldKey := ed25519PEM(t)
+	loadKeys(t, map[string]string{"JWT_SIGNING_ALG": "EdDSA", "JWT_PRIVATE_KEY": oldPEM, "JWT_SECRET": "secret-a"})
+	oldToken, err := GenerateJWT(models.User{ID: 7}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(oldToken); err != nil {
+		t.Errorf("EdDSA token rejected: %v", err)
+	}
+
+	// JWT_SECRET is not an access token key once tokens are signed with EdDSA
+	hsToken := signTestToken(t, jwt.SigningMethodHS256, []byte("secret-a"), hmacKey("secret-a").id)
+	if _, err := ValidateJWT(hsToken); err == nil {
+		t.Error("HS256 token accepted in EdDSA mode")
+	}
+	if _, err := ValidateJWT(signTestToken(t, jwt.SigningMethodHS256, []byte("secret-a"), "")); err == nil {
+		t.Error("HS256 token without kid accepted in EdDSA mode")
+	}
+
+	// An HS256 token naming the EdDSA kid, keyed with the public key, must
+	// not pass as that key
+	oldID, err := publicJWTKey(oldKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	confused := signTestToken(t, jwt.SigningMethodHS256, []byte(oldKey.Public().(ed25519.PublicKey)), oldID.id)
+	if _, err := ValidateJWT(confused); err == nil {
+		t.Error("HS256 token naming an EdDSA kid accepted")
+	}
+
+	// Rotating the key pair keeps tokens of the previous public key valid
+	newPEM, _ := ed25519PEM(t)
+	previous := filepath.Join(t.TempDir(), "previous.pem")
+	if err := os.WriteFile(previous, []byte(oldPEM), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loadKeys(t, map[string]string{
+		"JWT_SIGNING_ALG": "EdDSA", "JWT_PRIVATE_KEY": newPEM, "JWT_PREVIOUS_PUBLIC_KEYS_FILE": previous,
+		"JWT_PREVIOUS_SECRETS": "secret-a",
+	})
+	if _, err := ValidateJWT(oldToken); err != nil {
+		t.Errorf("token of the previous key pair rejected: %v", err)
+	}
+	if _, err := ValidateJWT(hsToken); err != nil {
+		t.Errorf("token of a secret listed in JWT_PREVIOUS_SECRETS rejected: %v", err)
+	}
+	jwks, err := PublicJWKs()
+	if err != nil || len(jwks) != 2 || jwks[0].Kid == oldID.id {
+		t.Errorf("PublicJWKs() = %+v, %v, want the new key first and the previous one", jwks, err)
+	}
+}
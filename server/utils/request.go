@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ClientIP returns the address of the client that made a request. The
+// X-Forwarded-For header is only trusted when TRUST_PROXY_HEADERS=true,
+// since clients can set it to anything when the server is reached directly.
+//
+// Each proxy appends the address it received the request from, so only the
+// entries added by our own proxies can be believed; anything to their left
+// may have been sent by the client. With TRUSTED_PROXIES (a comma-separated
+// list of CIDRs or addresses) the header is walked from the right past every
+// trusted proxy. Otherwise TRUSTED_PROXY_HOPS (default 1) is the number of
+// proxies in front of the server, and the entry the outermost one added is
+// used.
+func ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if os.Getenv("TRUST_PROXY_HEADERS") != "true" {
+		return remote
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				forwarded = append(forwarded, entry)
+			}
+		}
+	}
+	if len(forwarded) == 0 {
+		return remote
+	}
+
+	if proxies := trustedProxies(); len(proxies) > 0 {
+		if !ipInNets(remote, proxies) {
+			// Reached directly, not through a proxy
+			return remote
+		}
+		for i := len(forwarded) - 1; i > 0; i-- {
+			if !ipInNets(forwarded[i], proxies) {
+				return forwarded[i]
+			}
+		}
+		return forwarded[0]
+	}
+
+	hops, err := strconv.Atoi(os.Getenv("TRUSTED_PROXY_HOPS"))
+	if err != nil || hops < 1 {
+		hops = 1
+	}
+	if hops > len(forwarded) {
+		return forwarded[0]
+	}
+	return forwarded[len(forwarded)-hops]
+}
+
+// trustedProxies parses TRUSTED_PROXIES; single addresses are treated as
+// one-address networks and invalid entries are ignored
+func trustedProxies() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				continue
+			}
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+// ipInNets reports whether addr is an IP address inside one of nets
+func ipInNets(addr string, nets []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     string
+		hops      string
+		proxies   string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"headers not trusted", "", "", "", "10.0.0.1:1234", []string{"203.0.113.7"}, "10.0.0.1"},
+		{"no header", "true", "", "", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"remote without port", "", "", "", "10.0.0.1", nil, "10.0.0.1"},
+		{"single proxy", "true", "", "", "10.0.0.1:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed leading entry", "true", "", "", "10.0.0.1:1234", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"spoofed entry in separate header", "true", "", "", "10.0.0.1:1234", []string{"1.2.3.4", "203.0.113.7"}, "203.0.113.7"},
+		{"two hops", "true", "2", "", "10.0.0.1:1234", []string{"1.2.3.4, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"more hops than entries", "true", "3", "", "10.0.0.1:1234", []string{"203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"invalid hops", "true", "zero", "", "10.0.0.1:1234", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"trusted proxies", "true", "", "10.0.0.0/8", "10.0.0.1:1234", []string{"1.2.3.4, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"untrusted remote", "true", "", "10.0.0.0/8", "198.51.100.9:1234", []string{"203.0.113.7"}, "198.51.100.9"},
+		{"all entries trusted", "true", "", "10.0.0.0/8", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"single trusted address", "true", "", "10.0.0.1", "10.0.0.1:1234", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"ipv6 remote", "", "", "", "[2001:db8::1]:443", nil, "2001:db8::1"},
+		{"ipv6 client", "true", "", "", "10.0.0.1:1234", []string{"1.2.3.4, 2001:db8::7"}, "2001:db8::7"},
+		{"ipv6 trusted proxies", "true", "", "fd00::/8", "[fd00::1]:443", []string{"1.2.3.4, 2001:db8::7, fd00::2"}, "2001:db8::7"},
+		{"ipv6 untrusted remote", "true", "", "fd00::/8", "[2001:db8::9]:443", []string{"2001:db8::7"}, "2001:db8::9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUST_PROXY_HEADERS", tt.trust)
+			t.Setenv("TRUSTED_PROXY_HOPS", tt.hops)
+			t.Setenv("TRUSTED_PROXIES", tt.proxies)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
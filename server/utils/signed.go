@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignedToken is returned for tampered, malformed or expired signed tokens
+var ErrInvalidSignedToken = errors.New("invalid or expired link")
+
+// signedEnvelope wraps the payload of a signed token with its purpose and expiry
+type signedEnvelope struct {
+	Purpose   string          `json:"p"`
+	ExpiresAt int64           `json:"x"`
+	Data      json.RawMessage `json:"d"`
+}
+
+// signedTokenSecret returns TOKEN_SIGNING_SECRET, the key of signed tokens,
+// kept apart from the access token keys so rotating those does not break
+// links already sent. It falls back to JWT_SECRET when unset; outside
+// development one of them must be set to a real secret.
+func signedTokenSecret() (string, error) {
+	return configuredSecret("TOKEN_SIGNING_SECRET", "JWT_SECRET")
+}
+
+// signingKey derives a key for one purpose from the signed token secret, so
+// a token signed for one use can never be accepted as another
+func signingKey(purpose string) ([]byte, error) {
+	secret, err := signedTokenSecret()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("signed-token:" + purpose))
+	return mac.Sum(nil), nil
+}
+
+// SignToken serializes data into a URL-safe token signed for purpose that
+// expires after ttl. Tokens are tamper-proof but not encrypted.
+func SignToken(purpose string, data interface{}, ttl time.Duration) (string, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(signedEnvelope{
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+		Data:      raw,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	key, err := signingKey(purpose)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifySignedToken checks a token produced by SignToken for the same purpose
+// and decodes its data into dest
+func VerifySignedToken(purpose, token string, dest interface{}) error {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidSignedToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return ErrInvalidSignedToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return ErrInvalidSignedToken
+	}
+
+	key, err := signingKey(purpose)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidSignedToken
+	}
+
+	var envelope signedEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return ErrInvalidSignedToken
+	}
+	if envelope.Purpose != purpose || time.Now().Unix() > envelope.ExpiresAt {
+		return ErrInvalidSignedToken
+	}
+	if err := json.Unmarshal(envelope.Data, dest); err != nil {
+		return ErrInvalidSignedToken
+	}
+	return nil
+}
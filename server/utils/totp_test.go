@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		wantStep int64
+		ok       bool
+	}{
+		{"current step", rfc6238Secret, "050471", 0, step, true},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), "050471", 0, step, true},
+		{"previous step", rfc6238Secret, "081804", 0, step - 1, true},
+		{"replayed", rfc6238Secret, "050471", step, 0, false},
+		{"wrong code", rfc6238Secret, "123456", 0, 0, false},
+		{"too short", rfc6238Secret, "50471", 0, 0, false},
+		{"too old", rfc6238Secret, "287082", 0, 0, false},
+		{"invalid secret", "not base32!", "050471", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, now, tt.lastStep)
+			if gotStep != tt.wantStep || ok != tt.ok {
+				t.Errorf("ValidateTOTP() = %d, %v, want %d, %v", gotStep, ok, tt.wantStep, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+	if other, _ := GenerateTOTPSecret(); other == secret {
+		t.Error("GenerateTOTPSecret returned the same secret twice")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Arouzy", "jane doe@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Arouzy:jane doe@example.com" {
+		t.Errorf("TOTPURI() = %s, want an otpauth://totp/ URI labelled issuer:account", uri)
+	}
+	query := uri.Query()
+	for name, want := range map[string]string{
+		"secret": rfc6238Secret, "issuer": "Arouzy", "algorithm": "SHA1", "digits": "6", "period": "30",
+	} {
+		if got := query.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// AppURL returns an absolute link into the frontend, based on APP_URL
+func AppURL(path string) string {
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:5173" // Default for development only
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// APIURL returns an absolute link to this server, based on API_URL
+func APIURL(path string) string {
+	base := os.Getenv("API_URL")
+	if base == "" {
+		base = "http://localhost:8080" // Default for development only
+	}
+	return strings.TrimRight(base, "/") + path
+}